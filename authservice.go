@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AuthService is the interface to the authentication and session servers
+// used during login. The default is an HTTPAuthService talking to Mojang's
+// servers; MemoryAuthService can stand in for them when running offline.
+type AuthService interface {
+	// Authenticate logs in to an account with a username and password.
+	Authenticate(username, password, clientToken string) (session *AuthSession, err error)
+	
+	// Validate checks that an access token can still be used.
+	Validate(accessToken, clientToken string) (err error)
+	
+	// Refresh exchanges an access token for a new one, without needing the
+	// account's password.
+	Refresh(accessToken, clientToken string) (session *AuthSession, err error)
+	
+	// Join tells the session server that the profile is joining the server
+	// identified by serverHash.
+	Join(accessToken, profileID, serverHash string) (err error)
+	
+	// HasJoined checks that the named player has joined the server identified
+	// by serverHash, returning their profile.
+	HasJoined(username, serverHash string) (profile *Profile, err error)
+}
+
+type AuthSession struct {
+	AccessToken string `json:"accessToken"`
+	ClientToken string `json:"clientToken"`
+	Profile Profile `json:"selectedProfile"`
+}
+
+type Profile struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Properties []ProfileProperty `json:"properties,omitempty"`
+}
+
+type ProfileProperty struct {
+	Name string `json:"name"`
+	Value string `json:"value"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type HTTPAuthService struct {
+	AuthServerURL string
+	SessionServerURL string
+	
+	// The client used for requests. NewHTTPAuthService gives it a timeout, so
+	// that a server that doesn't answer can't hold up logins forever.
+	Client *http.Client
+}
+
+// How long NewHTTPAuthService's client waits for each request.
+const authRequestTimeout = 10 * time.Second
+
+func NewHTTPAuthService() (service *HTTPAuthService) {
+	return &HTTPAuthService{
+		AuthServerURL: "https://authserver.mojang.com",
+		SessionServerURL: "https://sessionserver.mojang.com",
+		Client: &http.Client{Timeout: authRequestTimeout},
+	}
+}
+
+func (service *HTTPAuthService) Authenticate(username, password, clientToken string) (session *AuthSession, err error) {
+	requestMessage := authenticateRequest{
+		Agent: authenticateAgent{
+			Name: "Minecraft",
+			Version: 1,
+		},
+		Username: username,
+		Password: password,
+		ClientToken: clientToken,
+	}
+	
+	var responseMessage authenticateResponse
+	err = service.post(service.AuthServerURL + "/authenticate", requestMessage, &responseMessage)
+	if err != nil {
+		return nil, err
+	}
+	
+	session = &AuthSession{
+		AccessToken: responseMessage.AccessToken,
+		ClientToken: responseMessage.ClientToken,
+		Profile: Profile{
+			ID: responseMessage.SelectedProfile.ID,
+			Name: responseMessage.SelectedProfile.Name,
+		},
+	}
+	
+	return session, nil
+}
+
+func (service *HTTPAuthService) Validate(accessToken, clientToken string) (err error) {
+	requestMessage := tokenRequest{
+		AccessToken: accessToken,
+		ClientToken: clientToken,
+	}
+	
+	return service.post(service.AuthServerURL + "/validate", requestMessage, nil)
+}
+
+func (service *HTTPAuthService) Refresh(accessToken, clientToken string) (session *AuthSession, err error) {
+	requestMessage := tokenRequest{
+		AccessToken: accessToken,
+		ClientToken: clientToken,
+	}
+	
+	var responseMessage authenticateResponse
+	err = service.post(service.AuthServerURL + "/refresh", requestMessage, &responseMessage)
+	if err != nil {
+		return nil, err
+	}
+	
+	session = &AuthSession{
+		AccessToken: responseMessage.AccessToken,
+		ClientToken: responseMessage.ClientToken,
+		Profile: Profile{
+			ID: responseMessage.SelectedProfile.ID,
+			Name: responseMessage.SelectedProfile.Name,
+		},
+	}
+	
+	return session, nil
+}
+
+func (service *HTTPAuthService) Join(accessToken, profileID, serverHash string) (err error) {
+	requestMessage := notifyJoinRequest{
+		AccessToken: accessToken,
+		SelectedProfile: profileID,
+		ServerID: serverHash,
+	}
+	
+	return service.post(service.SessionServerURL + "/session/minecraft/join", requestMessage, nil)
+}
+
+func (service *HTTPAuthService) HasJoined(username, serverHash string) (profile *Profile, err error) {
+	params := make(url.Values)
+	params.Set("username", username)
+	params.Set("serverId", serverHash)
+	
+	resp, err := service.Client.Get(service.SessionServerURL + "/session/minecraft/hasJoined?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP authentication error: %s", resp.Status)
+	}
+	
+	// The session server answers with no content if the client never joined.
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, fmt.Errorf("Authentication failure")
+	}
+	
+	profile = &Profile{}
+	dec := json.NewDecoder(resp.Body)
+	err = dec.Decode(profile)
+	if err != nil {
+		return nil, err
+	}
+	
+	return profile, nil
+}
+
+func (service *HTTPAuthService) post(url string, requestMessage interface{}, responseMessage interface{}) (err error) {
+	requestJson, err := json.Marshal(requestMessage)
+	if err != nil {
+		return err
+	}
+	
+	resp, err := service.Client.Post(url, "application/json", bytes.NewReader(requestJson))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP authentication error: %s", resp.Status)
+	}
+	
+	if responseMessage == nil {
+		return nil
+	}
+	
+	dec := json.NewDecoder(resp.Body)
+	return dec.Decode(responseMessage)
+}
+
+type authenticateRequest struct {
+	Agent authenticateAgent `json:"agent"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientToken string `json:"clientToken,omitempty"`
+}
+
+type authenticateAgent struct {
+	Name string `json:"name"`
+	Version int `json:"version"`
+}
+
+type authenticateResponse struct {
+	AccessToken string `json:"accessToken"`
+	ClientToken string `json:"clientToken"`
+	AvailableProfiles []authenticateProfile `json:"availableProfiles"`
+	SelectedProfile authenticateProfile `json:"selectedProfile"`
+}
+
+type authenticateProfile struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+type tokenRequest struct {
+	AccessToken string `json:"accessToken"`
+	ClientToken string `json:"clientToken"`
+}
+
+type notifyJoinRequest struct {
+	AccessToken string `json:"accessToken"`
+	SelectedProfile string `json:"selectedProfile"`
+	ServerID string `json:"serverId"`
+}
@@ -0,0 +1,441 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func mustDecodeHex(s string) (buf []byte) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+// roundTripTest describes a value that should be written as data, and read
+// back from it again, in a protocol version.
+type roundTripTest struct {
+	name string
+	version uint64
+	data string
+	write func(w BinaryWriter) error
+	read func(r BinaryReader) (interface{}, error)
+	value interface{}
+}
+
+func runRoundTripTests(t *testing.T, tests []roundTripTest) {
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		
+		err := test.write(NewVersionedBinaryWriter(buf, test.version))
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if hex.EncodeToString(buf.Bytes()) != test.data {
+			t.Errorf("%s: wrote %x, expected %s", test.name, buf.Bytes(), test.data)
+			continue
+		}
+		
+		value, err := test.read(NewVersionedBinaryReader(buf, test.version))
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, buf.Len())
+		}
+		
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: read %#v, expected %#v", test.name, value, test.value)
+		}
+	}
+}
+
+func varint32Test(x int32, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "varint32 " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteVarint32(x) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadVarint32() },
+		value: x,
+	}
+}
+
+func varintTest(x uint64, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "varint " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteVarint(x) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadVarint() },
+		value: x,
+	}
+}
+
+func varint64Test(x int64, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "varint64 " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteVarint64(x) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadVarint64() },
+		value: x,
+	}
+}
+
+func TestVarintRoundTrip(t *testing.T) {
+	runRoundTripTests(t, []roundTripTest{
+		varint32Test(0, "00"),
+		varint32Test(1, "01"),
+		varint32Test(127, "7f"),
+		varint32Test(128, "8001"),
+		varint32Test(255, "ff01"),
+		varint32Test(25565, "ddc701"),
+		varint32Test(2147483647, "ffffffff07"),
+		varint32Test(-1, "ffffffff0f"),
+		varint32Test(-2147483648, "8080808008"),
+		varintTest(0, "00"),
+		varintTest(300, "ac02"),
+		varintTest(4294967295, "ffffffff0f"),
+		varint64Test(0, "00"),
+		varint64Test(2147483647, "ffffffff07"),
+		varint64Test(9223372036854775807, "ffffffffffffffff7f"),
+		varint64Test(-1, "ffffffffffffffffff01"),
+		varint64Test(-2147483648, "80808080f8ffffffff01"),
+		varint64Test(-9223372036854775808, "80808080808080808001"),
+	})
+}
+
+func positionTest(version uint64, pos Position, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "position " + data,
+		version: version,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WritePosition(pos) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadPosition() },
+		value: pos,
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	runRoundTripTests(t, []roundTripTest{
+		// X, Y, Z before 1.14.
+		positionTest(340, Position{1, 2, 3}, "0000004008000003"),
+		positionTest(340, Position{18357644, 831, -20882616}, "4607630cfec15b48"),
+		positionTest(340, Position{-33554432, -2048, 33554431}, "8000002001ffffff"),
+		
+		// X, Z, Y from 1.14, and when the version isn't known.
+		positionTest(477, Position{1, 2, 3}, "0000004000003002"),
+		positionTest(477, Position{18357644, 831, -20882616}, "4607632c15b4833f"),
+		positionTest(477, Position{-33554432, -2048, 33554431}, "8000001ffffff800"),
+		positionTest(0, Position{18357644, 831, -20882616}, "4607632c15b4833f"),
+	})
+}
+
+func angleTest(degrees float32, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "angle " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteAngle(degrees) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadAngle() },
+		value: degrees,
+	}
+}
+
+func fixedPoint32Test(x float64, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "fixed point int32 " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteFixedPoint32(x) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadFixedPoint32() },
+		value: x,
+	}
+}
+
+func fixedPoint8Test(x float64, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "fixed point int8 " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteFixedPoint8(x) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadFixedPoint8() },
+		value: x,
+	}
+}
+
+func TestAngleAndFixedPointRoundTrip(t *testing.T) {
+	runRoundTripTests(t, []roundTripTest{
+		angleTest(0, "00"),
+		angleTest(90, "40"),
+		angleTest(180, "80"),
+		angleTest(270, "c0"),
+		angleTest(1.40625, "01"),
+		fixedPoint32Test(0, "00000000"),
+		fixedPoint32Test(1.5, "00000030"),
+		fixedPoint32Test(-0.25, "fffffff8"),
+		fixedPoint32Test(-30000000, "c6c79000"),
+		fixedPoint8Test(3.96875, "7f"),
+		fixedPoint8Test(-4, "80"),
+	})
+}
+
+func TestAngleRounding(t *testing.T) {
+	tests := []struct {
+		degrees float32
+		data string
+	}{
+		{359, "ff"},
+		{360, "00"},
+		{-90, "c0"},
+		{0.7, "00"},
+		{0.71, "01"},
+	}
+	
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		
+		err := NewBinaryWriter(buf).WriteAngle(test.degrees)
+		if err != nil {
+			t.Errorf("angle %v: write failed: %s", test.degrees, err.Error())
+			continue
+		}
+		
+		if hex.EncodeToString(buf.Bytes()) != test.data {
+			t.Errorf("angle %v: wrote %x, expected %s", test.degrees, buf.Bytes(), test.data)
+		}
+	}
+}
+
+func bitSetTest(bs BitSet, data string) (test roundTripTest) {
+	return roundTripTest{
+		name: "bit set " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteBitSet(bs) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadBitSet() },
+		value: bs,
+	}
+}
+
+func fixedBitSetTest(bs BitSet, n int, data string, expected BitSet) (test roundTripTest) {
+	return roundTripTest{
+		name: "fixed bit set " + data,
+		data: data,
+		write: func(w BinaryWriter) error { return w.WriteFixedBitSet(bs, n) },
+		read: func(r BinaryReader) (interface{}, error) { return r.ReadFixedBitSet(n) },
+		value: expected,
+	}
+}
+
+func TestBitSetRoundTrip(t *testing.T) {
+	runRoundTripTests(t, []roundTripTest{
+		bitSetTest(nil, "00"),
+		bitSetTest(BitSet{1}, "010000000000000001"),
+		bitSetTest(BitSet{0x8000000000000001, 5}, "0280000000000000010000000000000005"),
+		fixedBitSetTest(BitSet{}, 0, "", BitSet{}),
+		fixedBitSetTest(BitSet{0x0102}, 16, "0201", BitSet{0x0102}),
+		fixedBitSetTest(BitSet{1, 1}, 65, "010000000000000001", BitSet{1, 1}),
+		
+		// Bits past n are not sent.
+		fixedBitSetTest(BitSet{0xffffffffffffffff}, 12, "ff0f", BitSet{0xfff}),
+		fixedBitSetTest(nil, 12, "0000", BitSet{0}),
+	})
+}
+
+func TestBitSetGetSet(t *testing.T) {
+	var bs BitSet
+	bs.Set(3, true)
+	bs.Set(64, true)
+	bs.Set(130, true)
+	bs.Set(64, false)
+	
+	if !reflect.DeepEqual(bs, BitSet{8, 0, 4}) {
+		t.Errorf("got %#v, expected %#v", bs, BitSet{8, 0, 4})
+	}
+	
+	for i, expected := range map[int]bool{-1: false, 3: true, 4: false, 64: false, 130: true, 1000: false} {
+		if bs.Get(i) != expected {
+			t.Errorf("bit %d: got %t, expected %t", i, bs.Get(i), expected)
+		}
+	}
+}
+
+func TestUUIDRoundTrip(t *testing.T) {
+	uuid, err := ParseUUID("069a79f4-44e9-4726-a5be-fca90e38aaf5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	unhyphenated, err := ParseUUID("069a79f444e94726a5befca90e38aaf5")
+	if err != nil || unhyphenated != uuid {
+		t.Errorf("unhyphenated UUID parsed as %s (%v)", unhyphenated.String(), err)
+	}
+	
+	for _, s := range []string{"", "069a79f4", "069a79f4-44e9-4726-a5be-fca90e38aaf5ff", "z69a79f4-44e9-4726-a5be-fca90e38aaf5"} {
+		_, err = ParseUUID(s)
+		if err == nil {
+			t.Errorf("invalid UUID %q parsed", s)
+		}
+	}
+	
+	runRoundTripTests(t, []roundTripTest{
+		{
+			name: "uuid",
+			data: "069a79f444e94726a5befca90e38aaf5",
+			write: func(w BinaryWriter) error { return w.WriteUUID(uuid) },
+			read: func(r BinaryReader) (interface{}, error) { return r.ReadUUID() },
+			value: uuid,
+		},
+	})
+	
+	if uuid.String() != "069a79f4-44e9-4726-a5be-fca90e38aaf5" {
+		t.Errorf("UUID formatted as %s", uuid.String())
+	}
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	elems := []uint16{1, 2, 0xffff}
+	
+	runRoundTripTests(t, []roundTripTest{
+		{
+			name: "string",
+			data: "0568656c6c6f",
+			write: func(w BinaryWriter) error { return w.WriteString("hello") },
+			read: func(r BinaryReader) (interface{}, error) { return r.ReadStringMax(5) },
+			value: "hello",
+		},
+		{
+			name: "multibyte string",
+			data: "03e282ac",
+			write: func(w BinaryWriter) error { return w.WriteString("€") },
+			read: func(r BinaryReader) (interface{}, error) { return r.ReadStringMax(1) },
+			value: "€",
+		},
+		{
+			name: "byte array",
+			data: "03010203",
+			write: func(w BinaryWriter) error { return w.WriteByteArray([]byte{1, 2, 3}) },
+			read: func(r BinaryReader) (interface{}, error) { return r.ReadByteArray(3) },
+			value: []byte{1, 2, 3},
+		},
+		{
+			name: "array",
+			data: "0300010002ffff",
+			write: func(w BinaryWriter) error {
+				return w.WriteArray(len(elems), func(i int) error {
+					return w.WriteUint16(elems[i])
+				})
+			},
+			read: func(r BinaryReader) (interface{}, error) {
+				var got []uint16
+				_, err := r.ReadArray(3, func(i int) (err error) {
+					x, err := r.ReadUint16()
+					got = append(got, x)
+					return err
+				})
+				return got, err
+			},
+			value: elems,
+		},
+	})
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		read func(r BinaryReader) error
+	}{
+		{"varint32 longer than 5 bytes", "ffffffffff01", func(r BinaryReader) (err error) {
+			_, err = r.ReadVarint32()
+			return err
+		}},
+		{"varint longer than 5 bytes", "ffffffffff01", func(r BinaryReader) (err error) {
+			_, err = r.ReadVarint()
+			return err
+		}},
+		{"varint64 longer than 10 bytes", "ffffffffffffffffffff01", func(r BinaryReader) (err error) {
+			_, err = r.ReadVarint64()
+			return err
+		}},
+		{"truncated varint", "ff", func(r BinaryReader) (err error) {
+			_, err = r.ReadVarint32()
+			return err
+		}},
+		{"negative length", "", func(r BinaryReader) (err error) {
+			_, err = r.ReadBytes(-1)
+			return err
+		}},
+		{"length past MaxDataLength", "", func(r BinaryReader) (err error) {
+			_, err = r.ReadBytes(MaxDataLength + 1)
+			return err
+		}},
+		{"truncated bytes", "0102", func(r BinaryReader) (err error) {
+			_, err = r.ReadBytes(3)
+			return err
+		}},
+		{"truncated large bytes", "0102", func(r BinaryReader) (err error) {
+			_, err = r.ReadBytes(10000)
+			return err
+		}},
+		{"string longer than max", "0568656c6c6f", func(r BinaryReader) (err error) {
+			_, err = r.ReadStringMax(4)
+			return err
+		}},
+		{"string length longer than max", "1568656c6c6f", func(r BinaryReader) (err error) {
+			_, err = r.ReadStringMax(5)
+			return err
+		}},
+		{"string length that overflows int", "ffffffffffffffff7f", func(r BinaryReader) (err error) {
+			_, err = r.ReadString()
+			return err
+		}},
+		{"byte array longer than max", "03010203", func(r BinaryReader) (err error) {
+			_, err = r.ReadByteArray(2)
+			return err
+		}},
+		{"byte array length that overflows int", "ffffffffffffffffff01", func(r BinaryReader) (err error) {
+			_, err = r.ReadByteArray(MaxDataLength)
+			return err
+		}},
+		{"array longer than max", "03000100020003", func(r BinaryReader) (err error) {
+			_, err = r.ReadArray(2, func(i int) (err error) {
+				_, err = r.ReadUint16()
+				return err
+			})
+			return err
+		}},
+		{"truncated array", "030001", func(r BinaryReader) (err error) {
+			_, err = r.ReadArray(3, func(i int) (err error) {
+				_, err = r.ReadUint16()
+				return err
+			})
+			return err
+		}},
+		{"bit set length that overflows int", "ffffffffffffffffff01", func(r BinaryReader) (err error) {
+			_, err = r.ReadBitSet()
+			return err
+		}},
+		{"truncated fixed bit set", "ff", func(r BinaryReader) (err error) {
+			_, err = r.ReadFixedBitSet(12)
+			return err
+		}},
+		{"truncated UUID", "069a79f444e94726", func(r BinaryReader) (err error) {
+			_, err = r.ReadUUID()
+			return err
+		}},
+		{"truncated position", "46076330", func(r BinaryReader) (err error) {
+			_, err = r.ReadPosition()
+			return err
+		}},
+	}
+	
+	for _, test := range tests {
+		err := test.read(NewBinaryReader(bytes.NewReader(mustDecodeHex(test.data))))
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
@@ -1,16 +1,48 @@
 package proxy
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
+	"fmt"
+	"github.com/kierdavis/proxy/nbt"
 	"io"
+	"io/ioutil"
+	"unicode/utf8"
+)
+
+const (
+	// Maximum length of a packet frame.
+	MaxPacketLength = 2097151
+	
+	// Maximum length of a packet body once decompressed. No single field may
+	// be longer than this either.
+	MaxDataLength = 8388608
+	
+	// Maximum length of a string, in characters.
+	MaxStringLength = 32767
 )
 
 type BinaryReader struct {
 	r io.Reader
+	version uint64
 }
 
 func NewBinaryReader(r io.Reader) (br BinaryReader) {
-	return BinaryReader{r}
+	return BinaryReader{r, 0}
+}
+
+// NewVersionedBinaryReader returns a BinaryReader for packets of the given
+// protocol version.
+func NewVersionedBinaryReader(r io.Reader, version uint64) (br BinaryReader) {
+	return BinaryReader{r, version}
+}
+
+// ProtocolVersion returns the protocol version of the packet being read, or 0
+// if it is not known.
+func (br BinaryReader) ProtocolVersion() uint64 {
+	return br.version
 }
 
 func (br BinaryReader) ReadByte() (x byte, err error) {
@@ -58,45 +90,242 @@ func (br BinaryReader) ReadInt64() (x int64, err error) {
 	return x, err
 }
 
+func (br BinaryReader) ReadFloat32() (x float32, err error) {
+	err = binary.Read(br.r, binary.BigEndian, &x)
+	return x, err
+}
+
+func (br BinaryReader) ReadFloat64() (x float64, err error) {
+	err = binary.Read(br.r, binary.BigEndian, &x)
+	return x, err
+}
+
+func (br BinaryReader) ReadBool() (x bool, err error) {
+	b, err := br.ReadUint8()
+	return b != 0, err
+}
+
+// ReadVarint reads an unsigned VarInt in at most 5 bytes.
 func (br BinaryReader) ReadVarint() (x uint64, err error) {
-	return binary.ReadUvarint(br)
+	return br.readVarintMax(5)
+}
+
+// ReadVarint32 reads a signed VarInt as used by Minecraft: a 32-bit two's
+// complement integer in at most 5 bytes.
+func (br BinaryReader) ReadVarint32() (x int32, err error) {
+	v, err := br.readVarintMax(5)
+	return int32(uint32(v)), err
+}
+
+// ReadVarint64 reads a signed VarLong as used by Minecraft: a 64-bit two's
+// complement integer in at most 10 bytes.
+func (br BinaryReader) ReadVarint64() (x int64, err error) {
+	v, err := br.readVarintMax(10)
+	return int64(v), err
+}
+
+// readVarintMax reads a VarInt or VarLong in at most maxBytes bytes.
+func (br BinaryReader) readVarintMax(maxBytes int) (x uint64, err error) {
+	for i := 0; i < maxBytes; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		
+		x |= uint64(b & 0x7f) << uint(7 * i)
+		if b & 0x80 == 0 {
+			return x, nil
+		}
+	}
+	
+	return 0, fmt.Errorf("Varint is longer than %d bytes", maxBytes)
 }
 
+// ReadBytes reads count bytes. The buffer grows as data arrives rather than
+// being allocated up front, so a bogus length can't be used to exhaust memory.
 func (br BinaryReader) ReadBytes(count int) (buf []byte, err error) {
-	buf = make([]byte, count)
-	pos := 0
+	if count < 0 || count > MaxDataLength {
+		return nil, fmt.Errorf("Invalid length %d", count)
+	}
 	
-	for pos < count {
-		n, err := br.r.Read(buf[pos:])
+	if count <= 4096 {
+		buf = make([]byte, count)
+		_, err = io.ReadFull(br.r, buf)
 		if err != nil {
 			return nil, err
 		}
-		pos += n
+		return buf, nil
 	}
 	
-	return buf, nil
+	b := bytes.NewBuffer(nil)
+	_, err = io.CopyN(b, br.r, int64(count))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	return b.Bytes(), nil
+}
+
+// ReadRemaining reads everything left in the underlying reader. It is only
+// useful for the last field of a packet body.
+func (br BinaryReader) ReadRemaining() (buf []byte, err error) {
+	return ioutil.ReadAll(br.r)
 }
 
 func (br BinaryReader) ReadString() (s string, err error) {
+	return br.ReadStringMax(MaxStringLength)
+}
+
+// ReadStringMax reads a string of at most max characters.
+func (br BinaryReader) ReadStringMax(max int) (s string, err error) {
 	length, err := br.ReadVarint()
 	if err != nil {
 		return "", err
 	}
 	
+	// Each character takes up to 4 bytes in UTF-8.
+	if length > uint64(max) * 4 {
+		return "", fmt.Errorf("String length %d exceeds maximum of %d characters", length, max)
+	}
+	
 	buf, err := br.ReadBytes(int(length))
 	if err != nil {
 		return "", err
 	}
 	
+	if utf8.RuneCount(buf) > max {
+		return "", fmt.Errorf("String exceeds maximum of %d characters", max)
+	}
+	
 	return string(buf), nil
 }
 
+// ReadByteArray reads a byte array prefixed with its length as a varint.
+func (br BinaryReader) ReadByteArray(max int) (buf []byte, err error) {
+	length, err := br.ReadVarint()
+	if err != nil {
+		return nil, err
+	}
+	
+	if length > uint64(max) {
+		return nil, fmt.Errorf("Array length %d exceeds maximum of %d", length, max)
+	}
+	
+	return br.ReadBytes(int(length))
+}
+
+// ReadArray reads an array prefixed with its length as a varint, calling
+// readElem to read each element.
+func (br BinaryReader) ReadArray(max int, readElem func(i int) error) (length int, err error) {
+	n, err := br.ReadVarint()
+	if err != nil {
+		return 0, err
+	}
+	
+	if n > uint64(max) {
+		return 0, fmt.Errorf("Array length %d exceeds maximum of %d", n, max)
+	}
+	
+	for i := 0; i < int(n); i++ {
+		err = readElem(i)
+		if err != nil {
+			return i, err
+		}
+	}
+	
+	return int(n), nil
+}
+
+// ReadUUID reads a UUID sent as 16 bytes.
+func (br BinaryReader) ReadUUID() (uuid UUID, err error) {
+	_, err = io.ReadFull(br.r, uuid[:])
+	return uuid, err
+}
+
+// ReadPosition reads a block position packed into 64 bits. The layout changed
+// in 1.14; if the protocol version isn't known, the newer layout is used.
+func (br BinaryReader) ReadPosition() (pos Position, err error) {
+	v, err := br.ReadInt64()
+	if err != nil {
+		return pos, err
+	}
+	
+	pos.X = int32(v >> 38)
+	if br.version != 0 && br.version < packedPositionVersion {
+		pos.Y = int32(v << 26 >> 52)
+		pos.Z = int32(v << 38 >> 38)
+	} else {
+		pos.Y = int32(v << 52 >> 52)
+		pos.Z = int32(v << 26 >> 38)
+	}
+	
+	return pos, nil
+}
+
+// ReadAngle reads a rotation sent in steps of 1/256 of a turn, returning it in
+// degrees.
+func (br BinaryReader) ReadAngle() (degrees float32, err error) {
+	x, err := br.ReadUint8()
+	return float32(x) * 360 / 256, err
+}
+
+// ReadFixedPoint32 reads a fixed-point number with 5 fractional bits sent as an
+// int32, as used for entity positions before 1.9.
+func (br BinaryReader) ReadFixedPoint32() (x float64, err error) {
+	v, err := br.ReadInt32()
+	return float64(v) / 32, err
+}
+
+// ReadFixedPoint8 reads a fixed-point number with 5 fractional bits sent as an
+// int8, as used for relative entity movement before 1.9.
+func (br BinaryReader) ReadFixedPoint8() (x float64, err error) {
+	v, err := br.ReadInt8()
+	return float64(v) / 32, err
+}
+
+// ReadBitSet reads a bit set sent as an array of int64s prefixed with its
+// length as a varint.
+func (br BinaryReader) ReadBitSet() (bs BitSet, err error) {
+	_, err = br.ReadArray(MaxDataLength / 8, func(i int) (err error) {
+		x, err := br.ReadUint64()
+		bs = append(bs, x)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	return bs, nil
+}
+
+// ReadFixedBitSet reads a bit set of n bits sent as ceil(n / 8) bytes.
+func (br BinaryReader) ReadFixedBitSet(n int) (bs BitSet, err error) {
+	buf, err := br.ReadBytes((n + 7) / 8)
+	if err != nil {
+		return nil, err
+	}
+	
+	bs = make(BitSet, (n + 63) / 64)
+	for i, b := range buf {
+		bs[i / 8] |= uint64(b) << uint(8 * (i % 8))
+	}
+	
+	return bs, nil
+}
+
 func (br BinaryReader) ReadPacket() (p []byte, err error) {
 	length, err := br.ReadVarint()
 	if err != nil {
 		return nil, err
 	}
 	
+	if length > MaxPacketLength {
+		return nil, fmt.Errorf("Packet length %d exceeds maximum of %d", length, MaxPacketLength)
+	}
+	
 	body, err := br.ReadBytes(int(length))
 	if err != nil {
 		return nil, err
@@ -105,44 +334,153 @@ func (br BinaryReader) ReadPacket() (p []byte, err error) {
 	return body, nil
 }
 
-func (br BinaryReader) ReadSlot() (slot *Slot, err error) {
-	item, err := br.ReadUint16()
+// ReadCompressedPacket reads a packet in the compressed frame format used once
+// compression has been enabled with the given threshold. The body is
+// decompressed into a buffer that grows as data arrives, so a bogus data length
+// can't be used to exhaust memory.
+func (br BinaryReader) ReadCompressedPacket(threshold int) (body []byte, err error) {
+	frame, err := br.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	
+	fr := bytes.NewReader(frame)
+	dataLength, err := NewBinaryReader(fr).ReadVarint()
 	if err != nil {
 		return nil, err
 	}
 	
-	if item == 0xffff {
-		return nil, nil
+	// A data length of zero means the body was below the threshold and was
+	// sent uncompressed.
+	if dataLength == 0 {
+		return frame[len(frame)-fr.Len():], nil
+	}
+	
+	if int64(dataLength) < int64(threshold) {
+		return nil, fmt.Errorf("Compressed packet length %d is below the threshold of %d", dataLength, threshold)
+	}
+	
+	if dataLength > MaxDataLength {
+		return nil, fmt.Errorf("Decompressed packet length %d exceeds maximum of %d", dataLength, MaxDataLength)
 	}
 	
-	count, err := br.ReadUint8()
+	zr, err := zlib.NewReader(fr)
 	if err != nil {
 		return nil, err
 	}
+	defer zr.Close()
 	
-	damage, err := br.ReadUint16()
+	// One byte more than the declared length is read, to catch bodies that
+	// are too long.
+	b := bytes.NewBuffer(nil)
+	_, err = io.Copy(b, io.LimitReader(zr, int64(dataLength) + 1))
 	if err != nil {
 		return nil, err
 	}
 	
-	nbtLength, err := br.ReadUint16()
+	if uint64(b.Len()) != dataLength {
+		return nil, fmt.Errorf("Compressed packet length %d does not match its declared length %d", b.Len(), dataLength)
+	}
+	
+	return b.Bytes(), nil
+}
+
+// ReadNBT reads an NBT tag, with or without a root name depending on the
+// protocol version. A missing tag is returned as nil.
+func (br BinaryReader) ReadNBT() (value interface{}, err error) {
+	if br.version != 0 && br.version < namelessNBTVersion {
+		_, value, err = nbt.Read(br.r)
+		return value, err
+	}
+	
+	return nbt.ReadNameless(br.r)
+}
+
+// ReadSlot reads the contents of an inventory slot in the layout used by the
+// protocol version, or the 1.20.2 layout if the version isn't known. Empty slots
+// are returned as nil.
+func (br BinaryReader) ReadSlot() (slot *Slot, err error) {
+	if br.version >= slotComponentsVersion {
+		return nil, fmt.Errorf("Slots are not supported in protocol version %d", br.version)
+	}
+	
+	slot = new(Slot)
+	
+	if br.version == 0 || br.version >= slotPresentVersion {
+		present, err := br.ReadBool()
+		if err != nil || !present {
+			return nil, err
+		}
+		
+		slot.Item, err = br.ReadVarint32()
+		if err != nil {
+			return nil, err
+		}
+	
+	} else {
+		item, err := br.ReadInt16()
+		if err != nil || item == -1 {
+			return nil, err
+		}
+		
+		slot.Item = int32(item)
+	}
+	
+	slot.Count, err = br.ReadInt8()
 	if err != nil {
 		return nil, err
 	}
 	
-	var nbt []byte
-	
-	if nbtLength != 0xffff {
-		nbt, err = br.ReadBytes(int(nbtLength))
+	if br.version != 0 && br.version < slotNoDamageVersion {
+		slot.Damage, err = br.ReadInt16()
 		if err != nil {
 			return nil, err
 		}
 	}
 	
-	return &Slot{
-		Item: item,
-		Count: count,
-		Damage: damage,
-		NBT: nbt,
-	}, nil
+	var tag interface{}
+	
+	if br.version != 0 && br.version < slotInlineNBTVersion {
+		tag, err = br.readGzippedNBT()
+	} else {
+		tag, err = br.ReadNBT()
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	if tag != nil {
+		c, ok := tag.(nbt.Compound)
+		if !ok {
+			t, _ := nbt.TypeOf(tag)
+			return nil, fmt.Errorf("Item NBT is a %s rather than a compound", t.String())
+		}
+		
+		slot.NBT = c
+	}
+	
+	return slot, nil
+}
+
+// readGzippedNBT reads an NBT tag gzipped and prefixed with its length, as sent
+// in slots before 1.8.
+func (br BinaryReader) readGzippedNBT() (value interface{}, err error) {
+	length, err := br.ReadInt16()
+	if err != nil || length == -1 {
+		return nil, err
+	}
+	
+	buf, err := br.ReadBytes(int(length))
+	if err != nil {
+		return nil, err
+	}
+	
+	zr, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	
+	_, value, err = nbt.Read(io.LimitReader(zr, MaxDataLength))
+	return value, err
 }
@@ -1,16 +1,35 @@
 package proxy
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
+	"fmt"
+	"github.com/kierdavis/proxy/nbt"
 	"io"
+	"math"
 )
 
 type BinaryWriter struct {
 	w io.Writer
+	version uint64
 }
 
 func NewBinaryWriter(w io.Writer) (br BinaryWriter) {
-	return BinaryWriter{w}
+	return BinaryWriter{w, 0}
+}
+
+// NewVersionedBinaryWriter returns a BinaryWriter for packets of the given
+// protocol version.
+func NewVersionedBinaryWriter(w io.Writer, version uint64) (br BinaryWriter) {
+	return BinaryWriter{w, version}
+}
+
+// ProtocolVersion returns the protocol version of the packet being written, or
+// 0 if it is not known.
+func (br BinaryWriter) ProtocolVersion() uint64 {
+	return br.version
 }
 
 func (br BinaryWriter) WriteByte(x byte) (err error) {
@@ -49,12 +68,39 @@ func (br BinaryWriter) WriteInt64(x int64) (err error) {
 	return binary.Write(br.w, binary.BigEndian, x)
 }
 
+func (br BinaryWriter) WriteFloat32(x float32) (err error) {
+	return binary.Write(br.w, binary.BigEndian, x)
+}
+
+func (br BinaryWriter) WriteFloat64(x float64) (err error) {
+	return binary.Write(br.w, binary.BigEndian, x)
+}
+
+func (br BinaryWriter) WriteBool(x bool) (err error) {
+	if x {
+		return br.WriteUint8(1)
+	}
+	return br.WriteUint8(0)
+}
+
 func (br BinaryWriter) WriteVarint(x uint64) (err error) {
 	buf := make([]byte, 32)
 	n := binary.PutUvarint(buf, x)
 	return br.WriteBytes(buf[:n])
 }
 
+// WriteVarint32 writes a signed VarInt as used by Minecraft. Negative numbers
+// always take 5 bytes.
+func (br BinaryWriter) WriteVarint32(x int32) (err error) {
+	return br.WriteVarint(uint64(uint32(x)))
+}
+
+// WriteVarint64 writes a signed VarLong as used by Minecraft. Negative numbers
+// always take 10 bytes.
+func (br BinaryWriter) WriteVarint64(x int64) (err error) {
+	return br.WriteVarint(uint64(x))
+}
+
 func (br BinaryWriter) WriteBytes(buf []byte) (err error) {
 	for len(buf) > 0 {
 		n, err := br.w.Write(buf)
@@ -76,7 +122,98 @@ func (br BinaryWriter) WriteString(s string) (err error) {
 	return br.WriteBytes([]byte(s))
 }
 
+// WriteByteArray writes a byte array prefixed with its length as a varint.
+func (br BinaryWriter) WriteByteArray(buf []byte) (err error) {
+	err = br.WriteVarint(uint64(len(buf)))
+	if err != nil {
+		return err
+	}
+	
+	return br.WriteBytes(buf)
+}
+
+// WriteArray writes an array of the given length prefixed with its length as a
+// varint, calling writeElem to write each element.
+func (br BinaryWriter) WriteArray(length int, writeElem func(i int) error) (err error) {
+	err = br.WriteVarint(uint64(length))
+	if err != nil {
+		return err
+	}
+	
+	for i := 0; i < length; i++ {
+		err = writeElem(i)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+func (br BinaryWriter) WriteUUID(uuid UUID) (err error) {
+	return br.WriteBytes(uuid[:])
+}
+
+// WritePosition writes a block position packed into 64 bits, in the layout
+// used by the protocol version (the newest if it isn't known).
+func (br BinaryWriter) WritePosition(pos Position) (err error) {
+	x := int64(pos.X) & 0x3ffffff
+	y := int64(pos.Y) & 0xfff
+	z := int64(pos.Z) & 0x3ffffff
+	
+	if br.version != 0 && br.version < packedPositionVersion {
+		return br.WriteInt64(x << 38 | y << 26 | z)
+	}
+	
+	return br.WriteInt64(x << 38 | z << 12 | y)
+}
+
+// WriteAngle writes a rotation in degrees as steps of 1/256 of a turn.
+func (br BinaryWriter) WriteAngle(degrees float32) (err error) {
+	return br.WriteUint8(uint8(int64(math.Floor(float64(degrees) * 256 / 360 + 0.5))))
+}
+
+// WriteFixedPoint32 writes a fixed-point number with 5 fractional bits as an
+// int32.
+func (br BinaryWriter) WriteFixedPoint32(x float64) (err error) {
+	return br.WriteInt32(int32(math.Floor(x * 32)))
+}
+
+// WriteFixedPoint8 writes a fixed-point number with 5 fractional bits as an
+// int8.
+func (br BinaryWriter) WriteFixedPoint8(x float64) (err error) {
+	return br.WriteInt8(int8(math.Floor(x * 32)))
+}
+
+// WriteBitSet writes a bit set as an array of int64s prefixed with its length
+// as a varint.
+func (br BinaryWriter) WriteBitSet(bs BitSet) (err error) {
+	return br.WriteArray(len(bs), func(i int) error {
+		return br.WriteUint64(bs[i])
+	})
+}
+
+// WriteFixedBitSet writes the first n bits of a bit set as ceil(n / 8) bytes.
+func (br BinaryWriter) WriteFixedBitSet(bs BitSet, n int) (err error) {
+	buf := make([]byte, (n + 7) / 8)
+	for i := range buf {
+		if i / 8 < len(bs) {
+			buf[i] = byte(bs[i / 8] >> uint(8 * (i % 8)))
+		}
+	}
+	
+	if n % 8 != 0 {
+		buf[len(buf) - 1] &= byte(1 << uint(n % 8)) - 1
+	}
+	
+	return br.WriteBytes(buf)
+}
+
 func (br BinaryWriter) WritePacket(p []byte) (err error) {
+	if len(p) > MaxPacketLength {
+		return fmt.Errorf("Packet length %d exceeds maximum of %d", len(p), MaxPacketLength)
+	}
+	
 	err = br.WriteVarint(uint64(len(p)))
 	if err != nil {
 		return err
@@ -85,34 +222,129 @@ func (br BinaryWriter) WritePacket(p []byte) (err error) {
 	return br.WriteBytes(p)
 }
 
+func (br BinaryWriter) WriteCompressedPacket(p []byte, threshold int) (err error) {
+	buf := bytes.NewBuffer(nil)
+	w := NewBinaryWriter(buf)
+	
+	if len(p) < threshold {
+		w.WriteVarint(0)
+		w.WriteBytes(p)
+		
+	} else {
+		w.WriteVarint(uint64(len(p)))
+		
+		zw := zlib.NewWriter(buf)
+		_, err = zw.Write(p)
+		if err != nil {
+			return err
+		}
+		
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+	}
+	
+	return br.WritePacket(buf.Bytes())
+}
+
+// WriteNBT writes an NBT tag, with or without a root name depending on the
+// protocol version. A nil value is written as a missing tag.
+func (br BinaryWriter) WriteNBT(value interface{}) (err error) {
+	if br.version != 0 && br.version < namelessNBTVersion {
+		return nbt.Write(br.w, "", value)
+	}
+	
+	return nbt.WriteNameless(br.w, value)
+}
+
+// WriteSlot writes the contents of an inventory slot in the layout used by the
+// protocol version, or the 1.20.2 layout if the version isn't known. A nil slot
+// is written as empty.
 func (br BinaryWriter) WriteSlot(slot *Slot) (err error) {
-	if slot == nil {
-		return br.WriteUint16(0xffff)
+	if br.version >= slotComponentsVersion {
+		return fmt.Errorf("Slots are not supported in protocol version %d", br.version)
+	}
+	
+	if br.version == 0 || br.version >= slotPresentVersion {
+		err = br.WriteBool(slot != nil)
+		if err != nil || slot == nil {
+			return err
+		}
+		
+		err = br.WriteVarint32(slot.Item)
+		if err != nil {
+			return err
+		}
+		
+	} else {
+		if slot == nil {
+			return br.WriteInt16(-1)
+		}
+		
+		if slot.Item < 0 || slot.Item > math.MaxInt16 {
+			return fmt.Errorf("Item ID %d can't be sent in protocol version %d", slot.Item, br.version)
+		}
+		
+		err = br.WriteInt16(int16(slot.Item))
+		if err != nil {
+			return err
+		}
 	}
 	
-	err = br.WriteUint16(slot.Item)
+	err = br.WriteInt8(slot.Count)
 	if err != nil {
 		return err
 	}
 	
-	err = br.WriteUint8(slot.Count)
+	if br.version != 0 && br.version < slotNoDamageVersion {
+		err = br.WriteInt16(slot.Damage)
+		if err != nil {
+			return err
+		}
+	}
+	
+	// A nil Compound would otherwise be written as an empty one.
+	var tag interface{}
+	if slot.NBT != nil {
+		tag = slot.NBT
+	}
+	
+	if br.version != 0 && br.version < slotInlineNBTVersion {
+		return br.writeGzippedNBT(tag)
+	}
+	
+	return br.WriteNBT(tag)
+}
+
+// writeGzippedNBT writes an NBT tag gzipped and prefixed with its length, as
+// sent in slots before 1.8.
+func (br BinaryWriter) writeGzippedNBT(value interface{}) (err error) {
+	if value == nil {
+		return br.WriteInt16(-1)
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	zw := gzip.NewWriter(buf)
+	
+	err = nbt.Write(zw, "", value)
 	if err != nil {
 		return err
 	}
 	
-	err = br.WriteUint16(slot.Damage)
+	err = zw.Close()
 	if err != nil {
 		return err
 	}
 	
-	if len(slot.NBT) == 0 {
-		return br.WriteUint16(0xffff)
+	if buf.Len() > math.MaxInt16 {
+		return fmt.Errorf("Compressed NBT of %d bytes is too long", buf.Len())
 	}
 	
-	err = br.WriteUint16(uint16(len(slot.NBT)))
+	err = br.WriteInt16(int16(buf.Len()))
 	if err != nil {
 		return err
 	}
 	
-	return br.WriteBytes(slot.NBT)
+	return br.WriteBytes(buf.Bytes())
 }
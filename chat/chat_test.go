@@ -0,0 +1,338 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kierdavis/proxy/nbt"
+	"reflect"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		component *Component
+	}{
+		{"text", `{"text":"hi"}`, Text("hi")},
+		{"empty text", `{"text":""}`, Text("")},
+		{"translate", `{"translate":"chat.type.text","with":[{"text":"bob"},{"text":"hi"}]}`, Translate("chat.type.text", Text("bob"), Text("hi"))},
+		{"translate without arguments", `{"translate":"multiplayer.disconnect.kicked"}`, Translate("multiplayer.disconnect.kicked")},
+		{"keybind", `{"keybind":"key.jump"}`, Keybind("key.jump")},
+		{"styles", `{"text":"x","color":"red","bold":true,"italic":false,"underlined":true,"strikethrough":false,"obfuscated":true}`, Text("x").SetColor(Red).SetBold(true).SetItalic(false).SetUnderlined(true).SetStrikethrough(false).SetObfuscated(true)},
+		{"hex colour", `{"text":"x","color":"#ff8000"}`, Text("x").SetColor("#ff8000")},
+		{"font and insertion", `{"text":"x","font":"minecraft:uniform","insertion":"hello"}`, Text("x").SetFont("minecraft:uniform").SetInsertion("hello")},
+		{"click event", `{"text":"x","clickEvent":{"action":"run_command","value":"/spawn"}}`, Text("x").SetClick(RunCommand, "/spawn")},
+		{"show_text hover event", `{"text":"x","hoverEvent":{"action":"show_text","contents":{"text":"tip"},"value":{"text":"tip"}}}`, Text("x").SetHover(Text("tip"))},
+		{"show_item hover event", `{"text":"x","hoverEvent":{"action":"show_item","contents":{"id":"minecraft:stone","count":2}}}`, &Component{
+			Text: "x",
+			Style: Style{HoverEvent: &HoverEvent{Action: ShowItem, Raw: json.RawMessage(`{"id":"minecraft:stone","count":2}`)}},
+		}},
+		{"extra", `{"text":"a","color":"gold","extra":[{"text":"b"},{"keybind":"key.jump","bold":true}]}`, Text("a").SetColor(Gold).Append(Text("b"), Keybind("key.jump").SetBold(true))},
+	}
+	
+	for _, test := range tests {
+		data := test.component.JSON()
+		if data != test.data {
+			t.Errorf("%s: wrote %s, expected %s", test.name, data, test.data)
+			continue
+		}
+		
+		c, err := ParseJSON(data)
+		if err != nil {
+			t.Errorf("%s: parse failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if !reflect.DeepEqual(c, test.component) {
+			t.Errorf("%s: parsed %s, expected %s", test.name, c.JSON(), test.data)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		component *Component
+	}{
+		{"string", `"hi"`, Text("hi")},
+		{"number", `1.5`, Text("1.5")},
+		{"boolean", `true`, Text("true")},
+		{"array", `["a",{"text":"b"},"c"]`, Text("a").Append(Text("b"), Text("c"))},
+		{"array with extra", `[{"text":"a","extra":["b"]},"c"]`, Text("a").Append(Text("b"), Text("c"))},
+		{"surrounding whitespace", " \n\"hi\" ", Text("hi")},
+		{"object without text", `{"color":"red"}`, Text("").SetColor(Red)},
+		{"translate arguments", `{"translate":"k","with":[1,"x"]}`, Translate("k", Text("1"), Text("x"))},
+		{"hover value", `{"text":"x","hoverEvent":{"action":"show_text","value":"tip"}}`, Text("x").SetHover(Text("tip"))},
+		{"hover contents preferred", `{"text":"x","hoverEvent":{"action":"show_text","contents":"new","value":"old"}}`, Text("x").SetHover(Text("new"))},
+		{"unknown fields", `{"text":"x","score":{"name":"a"}}`, Text("x")},
+	}
+	
+	for _, test := range tests {
+		c, err := ParseJSON(test.data)
+		if err != nil {
+			t.Errorf("%s: parse failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if !reflect.DeepEqual(c, test.component) {
+			t.Errorf("%s: parsed %s, expected %s", test.name, c.JSON(), test.component.JSON())
+		}
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty input", ""},
+		{"whitespace", "  "},
+		{"null", "null"},
+		{"empty array", "[]"},
+		{"truncated object", `{"text":"x"`},
+		{"truncated array", `["a",`},
+		{"bad literal", `tru`},
+		{"number as text", `{"text":5}`},
+		{"string as bold", `{"text":"x","bold":"yes"}`},
+		{"object as extra", `{"text":"x","extra":{}}`},
+		{"empty array in extra", `{"text":"x","extra":[[]]}`},
+		{"empty hover contents", `{"text":"x","hoverEvent":{"action":"show_text","contents":[]}}`},
+		{"hover event not an object", `{"text":"x","hoverEvent":"tip"}`},
+		{"click value not a string", `{"text":"x","clickEvent":{"action":"open_url","value":1}}`},
+	}
+	
+	for _, test := range tests {
+		_, err := ParseJSON(test.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestJSONInvalidHover(t *testing.T) {
+	c := Text("a").Append(Text("b"))
+	c.HoverEvent = &HoverEvent{Action: ShowItem, Raw: json.RawMessage(`{`)}
+	
+	// The component can't be written as it is, so it is sent as plain text.
+	if c.JSON() != `{"text":"ab"}` {
+		t.Errorf("Wrote %s, expected plain text", c.JSON())
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		component *Component
+		legacy string
+		plain string
+	}{
+		{"plain text", Text("hi"), "hi", "hi"},
+		{"empty", Text(""), "", ""},
+		{"colour", Text("x").SetColor(Red), "§cx", "x"},
+		{"formatting after colour", Text("x").SetColor(Gold).SetBold(true).SetUnderlined(true), "§6§l§nx", "x"},
+		{"all formatting", Text("x").SetObfuscated(true).SetBold(true).SetStrikethrough(true).SetUnderlined(true).SetItalic(true), "§r§k§l§m§n§ox", "x"},
+		{"hex colour", Text("x").SetColor("#ff5556"), "§cx", "x"},
+		{"unknown colour", Text("x").SetColor("pink"), "§rx", "x"},
+		{"inherited style", Text("a").SetColor(Red).Append(Text("b").SetBold(true), Text("c")), "§ca§c§lb§cc", "abc"},
+		{"overridden style", Text("a").SetItalic(true).Append(Text("b").SetItalic(false)), "§r§oa§rb", "ab"},
+		{"same style not repeated", Text("a").SetColor(Aqua).Append(Text("b").SetColor(Aqua)), "§bab", "ab"},
+		{"translate", Translate("%s says %s", Text("bob").SetColor(Yellow), Text("hi")), "§ebob§r says hi", "bob says hi"},
+		{"positional arguments", Translate("%2$s %1$s", Text("a"), Text("b")), "b a", "b a"},
+		{"escaped percent", Translate("100%% %d", Text("sure")), "100% sure", "100% sure"},
+		{"missing arguments", Translate("a%sb%3$sc", Text("1")), "a1bc", "a1bc"},
+		{"keybind", Keybind("key.jump"), "key.jump", "key.jump"},
+		{"nil extra", Text("a").Append(nil, Text("b")), "ab", "ab"},
+	}
+	
+	for _, test := range tests {
+		legacy := test.component.Legacy()
+		if legacy != test.legacy {
+			t.Errorf("%s: wrote %q, expected %q", test.name, legacy, test.legacy)
+		}
+		
+		plain := test.component.Plain()
+		if plain != test.plain {
+			t.Errorf("%s: wrote plain text %q, expected %q", test.name, plain, test.plain)
+		}
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		component *Component
+		
+		// Whether Legacy gives data back again.
+		roundTrip bool
+	}{
+		{"plain text", "hi", Text("hi"), true},
+		{"empty", "", Text(""), true},
+		{"colour", "§cx", Text("x").SetColor(Red), true},
+		{"upper case code", "§Cx", Text("x").SetColor(Red), false},
+		{"formatting", "§c§k§l§m§n§ox", Text("x").SetColor(Red).SetObfuscated(true).SetBold(true).SetStrikethrough(true).SetUnderlined(true).SetItalic(true), true},
+		{"formatting without colour", "§lx", Text("x").SetBold(true), false},
+		{"colour resets formatting", "§l§cx", Text("x").SetColor(Red), false},
+		{"several parts", "§cHello §c§lbold§r plain", Text("").Append(Text("Hello ").SetColor(Red), Text("bold").SetColor(Red).SetBold(true), Text(" plain")), true},
+		{"unknown code", "§zx", Text("§zx"), true},
+		{"trailing section sign", "x§", Text("x§"), true},
+		{"codes without text", "x§c§l", Text("x"), false},
+	}
+	
+	for _, test := range tests {
+		c := ParseLegacy(test.data)
+		if !reflect.DeepEqual(c, test.component) {
+			t.Errorf("%s: parsed %s, expected %s", test.name, c.JSON(), test.component.JSON())
+			continue
+		}
+		
+		if test.roundTrip && c.Legacy() != test.data {
+			t.Errorf("%s: wrote %q back", test.name, c.Legacy())
+		}
+	}
+}
+
+func TestNBTRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		component *Component
+		tag nbt.Compound
+	}{
+		{"text", Text("hi"), nbt.Compound{"text": "hi"}},
+		{"translate", Translate("k", Text("a")), nbt.Compound{
+			"translate": "k",
+			"with": nbt.List{nbt.TagCompound, []interface{}{nbt.Compound{"text": "a"}}},
+		}},
+		{"keybind", Keybind("key.jump"), nbt.Compound{"keybind": "key.jump"}},
+		{"styles", Text("x").SetColor(Red).SetBold(true).SetItalic(false).SetFont("minecraft:alt").SetInsertion("i"), nbt.Compound{
+			"text": "x",
+			"color": "red",
+			"bold": int8(1),
+			"italic": int8(0),
+			"font": "minecraft:alt",
+			"insertion": "i",
+		}},
+		{"click event", Text("x").SetClick(OpenURL, "https://example.com"), nbt.Compound{
+			"text": "x",
+			"clickEvent": nbt.Compound{"action": "open_url", "value": "https://example.com"},
+		}},
+		{"show_text hover event", Text("x").SetHover(Text("tip").SetItalic(true)), nbt.Compound{
+			"text": "x",
+			"hoverEvent": nbt.Compound{"action": "show_text", "contents": nbt.Compound{"text": "tip", "italic": int8(1)}},
+		}},
+		{"show_item hover event", &Component{
+			Text: "x",
+			Style: Style{HoverEvent: &HoverEvent{Action: ShowItem, Raw: json.RawMessage(`{"count":2,"id":"minecraft:stone","tag":{"big":5000000000,"f":1.5,"l":["a","b"]}}`)}},
+		}, nbt.Compound{
+			"text": "x",
+			"hoverEvent": nbt.Compound{"action": "show_item", "contents": nbt.Compound{
+				"count": int32(2),
+				"id": "minecraft:stone",
+				"tag": nbt.Compound{
+					"big": int64(5000000000),
+					"f": float64(1.5),
+					"l": nbt.List{nbt.TagString, []interface{}{"a", "b"}},
+				},
+			}},
+		}},
+		{"extra", Text("a").Append(Text("b"), Text("c").SetColor(Blue)), nbt.Compound{
+			"text": "a",
+			"extra": nbt.List{nbt.TagCompound, []interface{}{nbt.Compound{"text": "b"}, nbt.Compound{"text": "c", "color": "blue"}}},
+		}},
+	}
+	
+	for _, test := range tests {
+		tag := test.component.NBT()
+		if !reflect.DeepEqual(tag, test.tag) {
+			t.Errorf("%s: wrote %#v, expected %#v", test.name, tag, test.tag)
+			continue
+		}
+		
+		buf := bytes.NewBuffer(nil)
+		err := nbt.WriteNameless(buf, tag)
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		value, err := nbt.ReadNameless(buf)
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		c, err := ParseNBT(value)
+		if err != nil {
+			t.Errorf("%s: parse failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if !reflect.DeepEqual(c, test.component) {
+			t.Errorf("%s: parsed %s, expected %s", test.name, c.JSON(), test.component.JSON())
+		}
+	}
+}
+
+func TestParseNBT(t *testing.T) {
+	tests := []struct {
+		name string
+		tag interface{}
+		component *Component
+	}{
+		{"string", "hi", Text("hi")},
+		{"int", int32(5), Text("5")},
+		{"double", float64(1.5), Text("1.5")},
+		{"list", nbt.List{nbt.TagString, []interface{}{"a", "b"}}, Text("a").Append(Text("b"))},
+		{"list of compounds", nbt.List{nbt.TagCompound, []interface{}{nbt.Compound{"text": "a", "extra": nbt.List{nbt.TagString, []interface{}{"b"}}}, nbt.Compound{"text": "c"}}}, Text("a").Append(Text("b"), Text("c"))},
+		{"hover contents as string", nbt.Compound{"text": "x", "hoverEvent": nbt.Compound{"action": "show_text", "contents": "tip"}}, Text("x").SetHover(Text("tip"))},
+		{"fields of the wrong type ignored", nbt.Compound{"text": int32(1), "bold": "yes", "extra": "b"}, Text("")},
+	}
+	
+	for _, test := range tests {
+		c, err := ParseNBT(test.tag)
+		if err != nil {
+			t.Errorf("%s: parse failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if !reflect.DeepEqual(c, test.component) {
+			t.Errorf("%s: parsed %s, expected %s", test.name, c.JSON(), test.component.JSON())
+		}
+	}
+}
+
+func TestParseNBTErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tag interface{}
+	}{
+		{"missing value", nil},
+		{"byte array", []byte{1}},
+		{"int array", []int32{1}},
+		{"empty list", nbt.List{Type: nbt.TagEnd}},
+		{"list of byte arrays", nbt.List{nbt.TagByteArray, []interface{}{[]byte{1}}}},
+		{"bad with", nbt.Compound{"translate": "k", "with": nbt.List{nbt.TagLongArray, []interface{}{[]int64{1}}}}},
+		{"bad extra", nbt.Compound{"text": "a", "extra": nbt.List{nbt.TagList, []interface{}{nbt.List{Type: nbt.TagEnd}}}}},
+		{"bad hover contents", nbt.Compound{"text": "x", "hoverEvent": nbt.Compound{"action": "show_text", "contents": []int32{1}}}},
+	}
+	
+	for _, test := range tests {
+		_, err := ParseNBT(test.tag)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestNBTInvalidHover(t *testing.T) {
+	c := Text("x")
+	c.HoverEvent = &HoverEvent{Action: ShowItem, Raw: json.RawMessage(`["a",1]`)}
+	
+	// An array that mixes types can't be a list, so the contents are dropped.
+	expected := nbt.Compound{"text": "x", "hoverEvent": nbt.Compound{"action": "show_item"}}
+	if !reflect.DeepEqual(c.NBT(), expected) {
+		t.Errorf("Wrote %#v, expected %#v", c.NBT(), expected)
+	}
+}
@@ -0,0 +1,180 @@
+// Package chat models Minecraft text components, as used in chat messages,
+// titles, disconnect reasons and the like.
+//
+// Components are built with Text or Translate and the Set methods:
+//
+//   msg := chat.Text("Hello from the proxy!").SetColor(chat.Red).SetBold(true)
+//
+// and sent as JSON (JSON), as NBT from 1.20.3 (NBT) or as a string of legacy
+// formatting codes (Legacy).
+package chat
+
+import (
+	"encoding/json"
+)
+
+// Named colours. A colour may also be given as "#rrggbb" from 1.16.
+const (
+	Black = "black"
+	DarkBlue = "dark_blue"
+	DarkGreen = "dark_green"
+	DarkAqua = "dark_aqua"
+	DarkRed = "dark_red"
+	DarkPurple = "dark_purple"
+	Gold = "gold"
+	Gray = "gray"
+	DarkGray = "dark_gray"
+	Blue = "blue"
+	Green = "green"
+	Aqua = "aqua"
+	Red = "red"
+	LightPurple = "light_purple"
+	Yellow = "yellow"
+	White = "white"
+)
+
+// Click event actions.
+const (
+	OpenURL = "open_url"
+	RunCommand = "run_command"
+	SuggestCommand = "suggest_command"
+	ChangePage = "change_page"
+	CopyToClipboard = "copy_to_clipboard"
+)
+
+// Hover event actions.
+const (
+	ShowText = "show_text"
+	ShowItem = "show_item"
+	ShowEntity = "show_entity"
+)
+
+// Component is a text component. Exactly one of Text, Translate and Keybind
+// gives its content; Text is used if the others are empty.
+type Component struct {
+	Text string
+	
+	// Translation key, and the components substituted into the translation.
+	Translate string
+	With []*Component
+	
+	// Name of a key binding, such as "key.jump".
+	Keybind string
+	
+	Style
+	
+	// Components that follow this one, inheriting its style.
+	Extra []*Component
+}
+
+// Style is the formatting of a component. Unset fields are inherited from the
+// parent component.
+type Style struct {
+	Color string
+	Bold *bool
+	Italic *bool
+	Underlined *bool
+	Strikethrough *bool
+	Obfuscated *bool
+	Font string
+	
+	// Text inserted into the chat box when the component is shift-clicked.
+	Insertion string
+	
+	ClickEvent *ClickEvent
+	HoverEvent *HoverEvent
+}
+
+type ClickEvent struct {
+	Action string `json:"action"`
+	Value string `json:"value"`
+}
+
+// HoverEvent is shown when the mouse is over a component. For ShowText the
+// text is in Contents; the contents of other actions aren't components and are
+// kept as JSON in Raw.
+type HoverEvent struct {
+	Action string
+	Contents *Component
+	Raw json.RawMessage
+}
+
+// Text returns a component containing the given text.
+func Text(text string) (c *Component) {
+	return &Component{Text: text}
+}
+
+// Translate returns a component that is translated by the client, with the
+// given components substituted into the translation.
+func Translate(key string, with ...*Component) (c *Component) {
+	return &Component{Translate: key, With: with}
+}
+
+// Keybind returns a component showing the key bound to the given binding.
+func Keybind(key string) (c *Component) {
+	return &Component{Keybind: key}
+}
+
+func (c *Component) SetColor(color string) *Component {
+	c.Color = color
+	return c
+}
+
+func (c *Component) SetBold(bold bool) *Component {
+	c.Bold = &bold
+	return c
+}
+
+func (c *Component) SetItalic(italic bool) *Component {
+	c.Italic = &italic
+	return c
+}
+
+func (c *Component) SetUnderlined(underlined bool) *Component {
+	c.Underlined = &underlined
+	return c
+}
+
+func (c *Component) SetStrikethrough(strikethrough bool) *Component {
+	c.Strikethrough = &strikethrough
+	return c
+}
+
+func (c *Component) SetObfuscated(obfuscated bool) *Component {
+	c.Obfuscated = &obfuscated
+	return c
+}
+
+func (c *Component) SetFont(font string) *Component {
+	c.Font = font
+	return c
+}
+
+func (c *Component) SetInsertion(insertion string) *Component {
+	c.Insertion = insertion
+	return c
+}
+
+// SetClick sets the action taken when the component is clicked, such as
+// OpenURL.
+func (c *Component) SetClick(action string, value string) *Component {
+	c.ClickEvent = &ClickEvent{Action: action, Value: value}
+	return c
+}
+
+// SetHover sets text shown when the mouse is over the component.
+func (c *Component) SetHover(text *Component) *Component {
+	c.HoverEvent = &HoverEvent{Action: ShowText, Contents: text}
+	return c
+}
+
+// Append adds components after this one.
+func (c *Component) Append(extra ...*Component) *Component {
+	c.Extra = append(c.Extra, extra...)
+	return c
+}
+
+// String returns the component as plain text, without formatting.
+func (c *Component) String() string {
+	return c.Plain()
+}
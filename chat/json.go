@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// componentJSON is the layout of a component as a JSON object.
+type componentJSON struct {
+	Text *string `json:"text,omitempty"`
+	Translate string `json:"translate,omitempty"`
+	With []*Component `json:"with,omitempty"`
+	Keybind string `json:"keybind,omitempty"`
+	Color string `json:"color,omitempty"`
+	Bold *bool `json:"bold,omitempty"`
+	Italic *bool `json:"italic,omitempty"`
+	Underlined *bool `json:"underlined,omitempty"`
+	Strikethrough *bool `json:"strikethrough,omitempty"`
+	Obfuscated *bool `json:"obfuscated,omitempty"`
+	Font string `json:"font,omitempty"`
+	Insertion string `json:"insertion,omitempty"`
+	ClickEvent *ClickEvent `json:"clickEvent,omitempty"`
+	HoverEvent *HoverEvent `json:"hoverEvent,omitempty"`
+	Extra []*Component `json:"extra,omitempty"`
+}
+
+// ParseJSON parses a component sent as JSON.
+func ParseJSON(s string) (c *Component, err error) {
+	c = new(Component)
+	err = json.Unmarshal([]byte(s), c)
+	if err != nil {
+		return nil, err
+	}
+	
+	return c, nil
+}
+
+// JSON returns the component as JSON, as sent in packets before 1.20.3 (and
+// in some packets after).
+func (c *Component) JSON() string {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		// Only a HoverEvent with invalid Raw JSON can get here.
+		buf, _ = json.Marshal(Text(c.Plain()))
+	}
+	
+	return string(buf)
+}
+
+func (c Component) MarshalJSON() ([]byte, error) {
+	cj := componentJSON{
+		Translate: c.Translate,
+		With: c.With,
+		Keybind: c.Keybind,
+		Color: c.Color,
+		Bold: c.Bold,
+		Italic: c.Italic,
+		Underlined: c.Underlined,
+		Strikethrough: c.Strikethrough,
+		Obfuscated: c.Obfuscated,
+		Font: c.Font,
+		Insertion: c.Insertion,
+		ClickEvent: c.ClickEvent,
+		HoverEvent: c.HoverEvent,
+		Extra: c.Extra,
+	}
+	
+	if c.Translate == "" && c.Keybind == "" {
+		cj.Text = &c.Text
+	}
+	
+	return json.Marshal(cj)
+}
+
+// UnmarshalJSON accepts a component in any of the forms the client does: an
+// object, a string, a number or boolean (read as text), or an array, whose
+// first element is the parent of the rest.
+func (c *Component) UnmarshalJSON(data []byte) (err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return fmt.Errorf("Empty component")
+	}
+	
+	switch data[0] {
+	case '{':
+		var cj componentJSON
+		err = json.Unmarshal(data, &cj)
+		if err != nil {
+			return err
+		}
+		
+		*c = Component{
+			Translate: cj.Translate,
+			With: cj.With,
+			Keybind: cj.Keybind,
+			Style: Style{
+				Color: cj.Color,
+				Bold: cj.Bold,
+				Italic: cj.Italic,
+				Underlined: cj.Underlined,
+				Strikethrough: cj.Strikethrough,
+				Obfuscated: cj.Obfuscated,
+				Font: cj.Font,
+				Insertion: cj.Insertion,
+				ClickEvent: cj.ClickEvent,
+				HoverEvent: cj.HoverEvent,
+			},
+			Extra: cj.Extra,
+		}
+		if cj.Text != nil {
+			c.Text = *cj.Text
+		}
+		return nil
+	
+	case '[':
+		var list []*Component
+		err = json.Unmarshal(data, &list)
+		if err != nil {
+			return err
+		}
+		
+		if len(list) == 0 {
+			return fmt.Errorf("Empty component array")
+		}
+		
+		*c = *list[0]
+		c.Extra = append(c.Extra, list[1:]...)
+		return nil
+	
+	case '"':
+		*c = Component{}
+		return json.Unmarshal(data, &c.Text)
+	
+	case 'n':
+		return fmt.Errorf("Null component")
+	}
+	
+	// Numbers and booleans are shown as they are written.
+	var v interface{}
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	
+	*c = Component{Text: string(data)}
+	return nil
+}
+
+type hoverEventJSON struct {
+	Action string `json:"action"`
+	Contents json.RawMessage `json:"contents,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MarshalJSON writes show_text contents both as "contents", read from 1.16,
+// and as "value", read by older clients.
+func (h HoverEvent) MarshalJSON() ([]byte, error) {
+	hj := hoverEventJSON{Action: h.Action, Contents: h.Raw}
+	
+	if h.Contents != nil {
+		buf, err := json.Marshal(h.Contents)
+		if err != nil {
+			return nil, err
+		}
+		
+		hj.Contents = buf
+		if h.Action == ShowText {
+			hj.Value = buf
+		}
+	}
+	
+	return json.Marshal(hj)
+}
+
+func (h *HoverEvent) UnmarshalJSON(data []byte) (err error) {
+	var hj hoverEventJSON
+	err = json.Unmarshal(data, &hj)
+	if err != nil {
+		return err
+	}
+	
+	contents := hj.Contents
+	if contents == nil {
+		contents = hj.Value
+	}
+	
+	*h = HoverEvent{Action: hj.Action}
+	
+	if h.Action == ShowText && contents != nil {
+		h.Contents = new(Component)
+		return json.Unmarshal(contents, h.Contents)
+	}
+	
+	h.Raw = contents
+	return nil
+}
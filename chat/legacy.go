@@ -0,0 +1,313 @@
+package chat
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The character that introduces a legacy formatting code.
+const SectionSign = '§'
+
+// Legacy colour codes, in code order.
+var legacyColors = []struct {
+	code byte
+	name string
+	rgb int
+}{
+	{'0', Black, 0x000000},
+	{'1', DarkBlue, 0x0000AA},
+	{'2', DarkGreen, 0x00AA00},
+	{'3', DarkAqua, 0x00AAAA},
+	{'4', DarkRed, 0xAA0000},
+	{'5', DarkPurple, 0xAA00AA},
+	{'6', Gold, 0xFFAA00},
+	{'7', Gray, 0xAAAAAA},
+	{'8', DarkGray, 0x555555},
+	{'9', Blue, 0x5555FF},
+	{'a', Green, 0x55FF55},
+	{'b', Aqua, 0x55FFFF},
+	{'c', Red, 0xFF5555},
+	{'d', LightPurple, 0xFF55FF},
+	{'e', Yellow, 0xFFFF55},
+	{'f', White, 0xFFFFFF},
+}
+
+// format is the effective style of some text, once inherited fields have been
+// filled in.
+type format struct {
+	color string
+	obfuscated bool
+	bold bool
+	strikethrough bool
+	underlined bool
+	italic bool
+}
+
+func (f format) with(s Style) format {
+	if s.Color != "" {
+		f.color = s.Color
+	}
+	if s.Obfuscated != nil {
+		f.obfuscated = *s.Obfuscated
+	}
+	if s.Bold != nil {
+		f.bold = *s.Bold
+	}
+	if s.Strikethrough != nil {
+		f.strikethrough = *s.Strikethrough
+	}
+	if s.Underlined != nil {
+		f.underlined = *s.Underlined
+	}
+	if s.Italic != nil {
+		f.italic = *s.Italic
+	}
+	return f
+}
+
+// codes returns the legacy codes that switch to the format. A colour code
+// resets the formatting codes, so they come after it.
+func (f format) codes() string {
+	code := byte('r')
+	if f.color != "" {
+		code = legacyColorCode(f.color)
+	}
+	
+	s := string([]rune{SectionSign, rune(code)})
+	flags := []struct {
+		set bool
+		code rune
+	}{
+		{f.obfuscated, 'k'},
+		{f.bold, 'l'},
+		{f.strikethrough, 'm'},
+		{f.underlined, 'n'},
+		{f.italic, 'o'},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			s += string([]rune{SectionSign, flag.code})
+		}
+	}
+	
+	return s
+}
+
+// legacyColorCode returns the code of a named colour, or of the named colour
+// nearest to a "#rrggbb" colour.
+func legacyColorCode(color string) byte {
+	for _, lc := range legacyColors {
+		if lc.name == color {
+			return lc.code
+		}
+	}
+	
+	if !strings.HasPrefix(color, "#") {
+		return 'r'
+	}
+	
+	rgb, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return 'r'
+	}
+	
+	best, bestDist := byte('r'), -1
+	for _, lc := range legacyColors {
+		dist := 0
+		for shift := uint(0); shift < 24; shift += 8 {
+			d := int((rgb >> shift) & 0xff) - (lc.rgb >> shift) & 0xff
+			dist += d * d
+		}
+		
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = lc.code, dist
+		}
+	}
+	
+	return best
+}
+
+// Legacy returns the component as text with legacy formatting codes, for
+// places that don't accept components, such as the server list before 1.7 or
+// plugin messages. Hex colours become the nearest named colour, and click and
+// hover events are lost.
+func (c *Component) Legacy() string {
+	r := &renderer{codes: true}
+	r.render(c, format{})
+	return r.buf.String()
+}
+
+// Plain returns the component's text without any formatting.
+func (c *Component) Plain() string {
+	r := &renderer{}
+	r.render(c, format{})
+	return r.buf.String()
+}
+
+type renderer struct {
+	buf bytes.Buffer
+	codes bool
+	last format
+}
+
+func (r *renderer) write(s string, f format) {
+	if s == "" {
+		return
+	}
+	
+	if r.codes && f != r.last {
+		r.buf.WriteString(f.codes())
+		r.last = f
+	}
+	
+	r.buf.WriteString(s)
+}
+
+// Matches %s, %d and %1$s style placeholders in translations, and %%.
+var placeholderRegexp = regexp.MustCompile(`%(?:(\d+)\$)?[sd]|%%`)
+
+func (r *renderer) render(c *Component, parent format) {
+	f := parent.with(c.Style)
+	
+	switch {
+	case c.Translate != "":
+		// The client's translations aren't available, so the key is used as
+		// the translation.
+		next := 0
+		rest := c.Translate
+		for {
+			loc := placeholderRegexp.FindStringSubmatchIndex(rest)
+			if loc == nil {
+				r.write(rest, f)
+				break
+			}
+			
+			r.write(rest[:loc[0]], f)
+			
+			if rest[loc[0]:loc[1]] == "%%" {
+				r.write("%", f)
+			} else {
+				i := next
+				if loc[2] >= 0 {
+					i, _ = strconv.Atoi(rest[loc[2]:loc[3]])
+					i--
+				} else {
+					next++
+				}
+				
+				if i >= 0 && i < len(c.With) && c.With[i] != nil {
+					r.render(c.With[i], f)
+				}
+			}
+			
+			rest = rest[loc[1]:]
+		}
+	
+	case c.Keybind != "":
+		r.write(c.Keybind, f)
+	
+	default:
+		r.write(c.Text, f)
+	}
+	
+	for _, extra := range c.Extra {
+		if extra != nil {
+			r.render(extra, f)
+		}
+	}
+}
+
+// ParseLegacy converts text with legacy formatting codes into a component.
+// Unknown codes are left in the text.
+func ParseLegacy(s string) (c *Component) {
+	c = Text("")
+	
+	var f format
+	var text []rune
+	
+	flush := func() {
+		if len(text) == 0 {
+			return
+		}
+		
+		part := Text(string(text))
+		part.Color = f.color
+		if f.obfuscated {
+			part.SetObfuscated(true)
+		}
+		if f.bold {
+			part.SetBold(true)
+		}
+		if f.strikethrough {
+			part.SetStrikethrough(true)
+		}
+		if f.underlined {
+			part.SetUnderlined(true)
+		}
+		if f.italic {
+			part.SetItalic(true)
+		}
+		
+		c.Extra = append(c.Extra, part)
+		text = nil
+	}
+	
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != SectionSign || i + 1 == len(runes) {
+			text = append(text, runes[i])
+			continue
+		}
+		
+		code := runes[i + 1]
+		if code >= 'A' && code <= 'Z' {
+			code += 'a' - 'A'
+		}
+		
+		next := f
+		switch code {
+		case 'k':
+			next.obfuscated = true
+		case 'l':
+			next.bold = true
+		case 'm':
+			next.strikethrough = true
+		case 'n':
+			next.underlined = true
+		case 'o':
+			next.italic = true
+		case 'r':
+			next = format{}
+		default:
+			color := ""
+			for _, lc := range legacyColors {
+				if rune(lc.code) == code {
+					color = lc.name
+				}
+			}
+			
+			if color == "" {
+				text = append(text, runes[i])
+				continue
+			}
+			
+			next = format{color: color}
+		}
+		
+		flush()
+		f = next
+		i++
+	}
+	
+	flush()
+	
+	// Unwrap a single part with nothing around it.
+	if len(c.Extra) == 1 {
+		return c.Extra[0]
+	}
+	
+	return c
+}
+
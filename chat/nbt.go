@@ -0,0 +1,316 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kierdavis/proxy/nbt"
+	"math"
+	"strconv"
+)
+
+// NBT returns the component as an NBT compound, as sent in packets from
+// 1.20.3.
+func (c *Component) NBT() (tag nbt.Compound) {
+	tag = nbt.Compound{}
+	
+	switch {
+	case c.Translate != "":
+		tag["translate"] = c.Translate
+		if len(c.With) > 0 {
+			tag["with"] = componentList(c.With)
+		}
+	case c.Keybind != "":
+		tag["keybind"] = c.Keybind
+	default:
+		tag["text"] = c.Text
+	}
+	
+	if c.Color != "" {
+		tag["color"] = c.Color
+	}
+	
+	flags := []struct {
+		name string
+		value *bool
+	}{
+		{"bold", c.Bold},
+		{"italic", c.Italic},
+		{"underlined", c.Underlined},
+		{"strikethrough", c.Strikethrough},
+		{"obfuscated", c.Obfuscated},
+	}
+	for _, f := range flags {
+		if f.value == nil {
+			continue
+		}
+		
+		if *f.value {
+			tag[f.name] = int8(1)
+		} else {
+			tag[f.name] = int8(0)
+		}
+	}
+	
+	if c.Font != "" {
+		tag["font"] = c.Font
+	}
+	if c.Insertion != "" {
+		tag["insertion"] = c.Insertion
+	}
+	
+	if c.ClickEvent != nil {
+		tag["clickEvent"] = nbt.Compound{"action": c.ClickEvent.Action, "value": c.ClickEvent.Value}
+	}
+	
+	if c.HoverEvent != nil {
+		hover := nbt.Compound{"action": c.HoverEvent.Action}
+		if c.HoverEvent.Contents != nil {
+			hover["contents"] = c.HoverEvent.Contents.NBT()
+		} else if c.HoverEvent.Raw != nil {
+			contents, err := jsonToNBT(c.HoverEvent.Raw)
+			if err == nil && contents != nil {
+				hover["contents"] = contents
+			}
+		}
+		tag["hoverEvent"] = hover
+	}
+	
+	if len(c.Extra) > 0 {
+		tag["extra"] = componentList(c.Extra)
+	}
+	
+	return tag
+}
+
+func componentList(components []*Component) (list nbt.List) {
+	list.Type = nbt.TagCompound
+	for _, c := range components {
+		list.Values = append(list.Values, c.NBT())
+	}
+	
+	return list
+}
+
+// ParseNBT parses a component sent as NBT. As well as compounds, it accepts a
+// string (read as text) and a list, whose first element is the parent of the
+// rest.
+func ParseNBT(tag interface{}) (c *Component, err error) {
+	switch x := tag.(type) {
+	case string:
+		return Text(x), nil
+	
+	case int8, int16, int32, int64, float32, float64:
+		return Text(fmt.Sprint(x)), nil
+	
+	case nbt.List:
+		if len(x.Values) == 0 {
+			return nil, fmt.Errorf("Empty component list")
+		}
+		
+		components, err := parseNBTList(x)
+		if err != nil {
+			return nil, err
+		}
+		
+		c = components[0]
+		c.Extra = append(c.Extra, components[1:]...)
+		return c, nil
+	
+	case nbt.Compound:
+		return parseNBTCompound(x)
+	}
+	
+	return nil, fmt.Errorf("Cannot parse %T as a component", tag)
+}
+
+func parseNBTList(list nbt.List) (components []*Component, err error) {
+	for i, value := range list.Values {
+		c, err := ParseNBT(value)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %s", i, err.Error())
+		}
+		
+		components = append(components, c)
+	}
+	
+	return components, nil
+}
+
+func parseNBTCompound(tag nbt.Compound) (c *Component, err error) {
+	c = new(Component)
+	
+	strs := []struct {
+		name string
+		value *string
+	}{
+		{"text", &c.Text},
+		{"translate", &c.Translate},
+		{"keybind", &c.Keybind},
+		{"color", &c.Color},
+		{"font", &c.Font},
+		{"insertion", &c.Insertion},
+	}
+	for _, f := range strs {
+		if s, ok := tag[f.name].(string); ok {
+			*f.value = s
+		}
+	}
+	
+	flags := []struct {
+		name string
+		value **bool
+	}{
+		{"bold", &c.Bold},
+		{"italic", &c.Italic},
+		{"underlined", &c.Underlined},
+		{"strikethrough", &c.Strikethrough},
+		{"obfuscated", &c.Obfuscated},
+	}
+	for _, f := range flags {
+		if b, ok := tag[f.name].(int8); ok {
+			v := b != 0
+			*f.value = &v
+		}
+	}
+	
+	if list, ok := tag["with"].(nbt.List); ok {
+		c.With, err = parseNBTList(list)
+		if err != nil {
+			return nil, fmt.Errorf("with%s", err.Error())
+		}
+	}
+	
+	if list, ok := tag["extra"].(nbt.List); ok {
+		c.Extra, err = parseNBTList(list)
+		if err != nil {
+			return nil, fmt.Errorf("extra%s", err.Error())
+		}
+	}
+	
+	if click, ok := tag["clickEvent"].(nbt.Compound); ok {
+		c.ClickEvent = &ClickEvent{}
+		c.ClickEvent.Action, _ = click["action"].(string)
+		c.ClickEvent.Value, _ = click["value"].(string)
+	}
+	
+	if hover, ok := tag["hoverEvent"].(nbt.Compound); ok {
+		c.HoverEvent = &HoverEvent{}
+		c.HoverEvent.Action, _ = hover["action"].(string)
+		
+		contents, ok := hover["contents"]
+		if ok && c.HoverEvent.Action == ShowText {
+			c.HoverEvent.Contents, err = ParseNBT(contents)
+			if err != nil {
+				return nil, fmt.Errorf("hoverEvent: %s", err.Error())
+			}
+		} else if ok {
+			c.HoverEvent.Raw, err = json.Marshal(nbtToJSON(contents))
+			if err != nil {
+				return nil, fmt.Errorf("hoverEvent: %s", err.Error())
+			}
+		}
+	}
+	
+	return c, nil
+}
+
+// jsonToNBT converts the contents of a hover event from JSON to NBT. Numbers
+// become ints, longs or doubles as they fit, and booleans become bytes.
+func jsonToNBT(data json.RawMessage) (tag interface{}, err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	
+	var v interface{}
+	err = d.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	
+	return jsonValueToNBT(v)
+}
+
+func jsonValueToNBT(v interface{}) (tag interface{}, err error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	
+	case bool:
+		if x {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int32(n), nil
+			}
+			return n, nil
+		}
+		return strconv.ParseFloat(x.String(), 64)
+	
+	case map[string]interface{}:
+		c := nbt.Compound{}
+		for name, elem := range x {
+			value, err := jsonValueToNBT(elem)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				c[name] = value
+			}
+		}
+		return c, nil
+	
+	case []interface{}:
+		list := nbt.List{Type: nbt.TagEnd}
+		for i, elem := range x {
+			value, err := jsonValueToNBT(elem)
+			if err != nil {
+				return nil, err
+			}
+			
+			t, _ := nbt.TypeOf(value)
+			if i == 0 {
+				list.Type = t
+			} else if t != list.Type {
+				return nil, fmt.Errorf("Array mixes %s and %s", list.Type.String(), t.String())
+			}
+			list.Values = append(list.Values, value)
+		}
+		return list, nil
+	}
+	
+	// null
+	return nil, nil
+}
+
+// nbtToJSON converts the contents of a hover event from NBT to values that
+// encoding/json can marshal.
+func nbtToJSON(tag interface{}) (v interface{}) {
+	switch x := tag.(type) {
+	case nbt.Compound:
+		m := make(map[string]interface{})
+		for name, elem := range x {
+			m[name] = nbtToJSON(elem)
+		}
+		return m
+	
+	case nbt.List:
+		a := make([]interface{}, 0, len(x.Values))
+		for _, elem := range x.Values {
+			a = append(a, nbtToJSON(elem))
+		}
+		return a
+	
+	case []byte:
+		a := make([]int8, len(x))
+		for i, b := range x {
+			a[i] = int8(b)
+		}
+		return a
+	}
+	
+	return tag
+}
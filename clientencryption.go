@@ -1,26 +1,30 @@
 package proxy
 
 import (
+	"crypto"
 	"crypto/rsa"
-	"encoding/json"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"net/url"
+	"time"
 )
 
 import crand "crypto/rand"
 
 type clientEncryptionManager struct {
 	gem *globalEncryptionManager
+	auth AuthService
 	playerName string
+	playerKey *LoginKey
 	playerUUID string
 	verifyToken []byte
 	sharedSecret []byte
 }
 
-func (gem *globalEncryptionManager) newClient(playerName string) (cem *clientEncryptionManager, err error) {
+func (gem *globalEncryptionManager) newClient(playerName string, playerKey *LoginKey, auth AuthService) (cem *clientEncryptionManager, err error) {
 	verifyToken := make([]byte, 16)
 	_, err = io.ReadFull(crand.Reader, verifyToken)
 	if err != nil {
@@ -29,7 +33,9 @@ func (gem *globalEncryptionManager) newClient(playerName string) (cem *clientEnc
 	
 	cem = &clientEncryptionManager{
 		gem: gem,
+		auth: auth,
 		playerName: playerName,
+		playerKey: playerKey,
 		verifyToken: verifyToken,
 	}
 	
@@ -52,6 +58,10 @@ func (cem *clientEncryptionManager) handleEncryptionResponse(packet *LS1Encrypti
 		return err
 	}
 	
+	if packet.EncryptedVerifyToken == nil {
+		return cem.checkSignature(packet.Salt, packet.Signature)
+	}
+	
 	returnedVerifyToken, err := rsa.DecryptPKCS1v15(crand.Reader, cem.gem.privateKey, packet.EncryptedVerifyToken)
 	if err != nil {
 		return err
@@ -73,43 +83,52 @@ func (cem *clientEncryptionManager) handleEncryptionResponse(packet *LS1Encrypti
 	return nil
 }
 
-func (cem *clientEncryptionManager) notifyHasJoined() (err error) {
-	log.Printf("notifyHasJoined")
-	
-	serverHash := AuthDigest(cem.gem.serverID, cem.sharedSecret, cem.gem.encodedPublicKey)
+// checkSignature checks the salt and signature that 1.19 and 1.19.1 clients
+// send in place of the verify token. They sign the verify token followed by the
+// salt with the chat signing key they sent in Login Start.
+func (cem *clientEncryptionManager) checkSignature(salt int64, signature []byte) (err error) {
+	if cem.playerKey == nil {
+		return fmt.Errorf("Signed encryption response without a chat signing key")
+	}
 	
-	params := make(url.Values)
-	params.Set("username", cem.playerName)
-	params.Set("serverId", serverHash)
+	if cem.playerKey.ExpiresAt < time.Now().UnixNano() / int64(time.Millisecond) {
+		return fmt.Errorf("Chat signing key has expired")
+	}
 	
-	resp, err := http.Get("https://sessionserver.mojang.com/session/minecraft/hasJoined?" + params.Encode())
+	key, err := x509.ParsePKIXPublicKey(cem.playerKey.PublicKey)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 	
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("HTTP authentication error: %s", resp.Status)
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("Chat signing key is not an RSA key")
 	}
 	
-	var responseMessage hasJoinedResponse
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&responseMessage)
+	data := make([]byte, len(cem.verifyToken) + 8)
+	copy(data, cem.verifyToken)
+	binary.BigEndian.PutUint64(data[len(cem.verifyToken):], uint64(salt))
+	
+	hash := sha256.Sum256(data)
+	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
 	if err != nil {
-		return err
+		return fmt.Errorf("Authentication failure")
 	}
 	
-	cem.playerUUID = responseMessage.UUID
-	
 	return nil
 }
 
-type hasJoinedResponse struct {
-	UUID string `json:"id"`
-	Properties []hasJoinedProperty `json:"properties"`
-}
-
-type hasJoinedProperty struct {
-	Name string `json:"name"`
-	Value interface{} `json:"value"`
+func (cem *clientEncryptionManager) notifyHasJoined() (err error) {
+	log.Printf("notifyHasJoined")
+	
+	serverHash := AuthDigest(cem.gem.serverID, cem.sharedSecret, cem.gem.encodedPublicKey)
+	
+	profile, err := cem.auth.HasJoined(cem.playerName, serverHash)
+	if err != nil {
+		return err
+	}
+	
+	cem.playerUUID = profile.ID
+	
+	return nil
 }
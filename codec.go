@@ -15,10 +15,11 @@ type codec struct {
 	bufw *bufio.Writer
 	binr BinaryReader
 	binw BinaryWriter
+	threshold int
 }
 
 func newCodec(conn io.ReadWriter) (c *codec) {
-	c = &codec{conn: conn}
+	c = &codec{conn: conn, threshold: -1}
 	c.bufr = bufio.NewReader(c.conn)
 	c.bufw = bufio.NewWriter(c.conn)
 	c.binr = NewBinaryReader(c.bufr)
@@ -28,34 +29,58 @@ func newCodec(conn io.ReadWriter) (c *codec) {
 }
 
 func (c *codec) Read() (packet []byte, err error) {
+	if c.threshold >= 0 {
+		return c.binr.ReadCompressedPacket(c.threshold)
+	}
 	return c.binr.ReadPacket()
 }
 
-func (c *codec) ReadAll(packetChan chan []byte, errChan chan error) {
+// ReadAll reads packets and sends them on packetChan until a read fails or
+// done is closed.
+func (c *codec) ReadAll(packetChan chan []byte, errChan chan error, done chan struct{}) {
 	for {
 		packet, err := c.Read()
 		if err != nil {
-			errChan <- err
+			select {
+			case errChan <- err:
+			case <-done:
+			}
 			return
 		}
 		
-		packetChan <- packet
+		select {
+		case packetChan <- packet:
+		case <-done:
+			return
+		}
 	}
 }
 
 func (c *codec) Write(packet []byte) (err error) {
-	err = c.binw.WritePacket(packet)
+	if c.threshold >= 0 {
+		err = c.binw.WriteCompressedPacket(packet, c.threshold)
+	} else {
+		err = c.binw.WritePacket(packet)
+	}
 	if err != nil {
 		return err
 	}
 	return c.bufw.Flush()
 }
 
-func (c *codec) WriteAll(packetChan chan []byte, errChan chan error) {
+// WriteAll writes the packets sent on packetChan until it is closed, then
+// closes finished. After a write fails the remaining packets are discarded, so
+// that senders never block.
+func (c *codec) WriteAll(packetChan chan []byte, errChan chan error, finished chan struct{}) {
+	defer close(finished)
+	
 	for packet := range packetChan {
 		err := c.Write(packet)
 		if err != nil {
 			errChan <- err
+			
+			for _ = range packetChan {
+			}
 			return
 		}
 	}
@@ -85,3 +110,12 @@ func (c *codec) Encrypt(sharedSecret []byte) (err error) {
 	
 	return nil
 }
+
+// SetCompression switches the codec to the compressed frame format, used for
+// every packet read or written after the Set Compression packet. Bodies of at
+// least threshold bytes are compressed when writing; a negative threshold
+// switches back to the uncompressed format.
+func (c *codec) SetCompression(threshold int) {
+	log.Printf("Setting compression threshold to %d", threshold)
+	c.threshold = threshold
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCodecCompressionFraming(t *testing.T) {
+	tests := []struct {
+		name string
+		threshold int
+		length int
+		compressed bool
+	}{
+		{"below threshold", 64, 63, false},
+		{"at threshold", 64, 64, true},
+		{"above threshold", 64, 1000, true},
+		{"one byte", 64, 1, false},
+		{"threshold of zero", 0, 1, true},
+		{"large body", 256, 100000, true},
+	}
+	
+	for _, test := range tests {
+		body := bytes.Repeat([]byte{0x2a}, test.length)
+		body[0] = 0x01
+		
+		buf := bytes.NewBuffer(nil)
+		c := newCodec(buf)
+		c.SetCompression(test.threshold)
+		
+		err := c.Write(body)
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		frame, err := NewBinaryReader(bytes.NewReader(buf.Bytes())).ReadPacket()
+		if err != nil {
+			t.Errorf("%s: reading frame failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		dataLength, n := binary.Uvarint(frame)
+		if test.compressed {
+			if dataLength != uint64(test.length) {
+				t.Errorf("%s: frame has data length %d, expected %d", test.name, dataLength, test.length)
+			}
+		} else {
+			if dataLength != 0 || !bytes.Equal(frame[n:], body) {
+				t.Errorf("%s: body was not sent uncompressed", test.name)
+			}
+		}
+		
+		packet, err := c.Read()
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if !bytes.Equal(packet, body) {
+			t.Errorf("%s: read a different body back", test.name)
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, buf.Len())
+		}
+	}
+}
+
+func TestCodecCompressionDisabled(t *testing.T) {
+	body := []byte("\x01hello")
+	
+	buf := bytes.NewBuffer(nil)
+	c := newCodec(buf)
+	c.SetCompression(64)
+	c.SetCompression(-1)
+	
+	err := c.Write(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !bytes.Equal(buf.Bytes(), []byte("\x06\x01hello")) {
+		t.Errorf("Wrote %x, expected an uncompressed frame", buf.Bytes())
+	}
+}
+
+func TestSetCompressionNegativeThreshold(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	c := newCodec(buf)
+	
+	err := testWrite(c, &LC3SetCompressionPacket{Threshold: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !bytes.Equal(buf.Bytes(), mustDecodeHex("0603ffffffff0f")) {
+		t.Errorf("Wrote %x", buf.Bytes())
+	}
+	
+	packet := &LC3SetCompressionPacket{}
+	err = testRead(c, packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if packet.Threshold != -1 {
+		t.Errorf("Read threshold %d, expected -1", packet.Threshold)
+	}
+}
+
+// compressedFrame returns a frame in the compressed format with the given data
+// length, holding body compressed.
+func compressedFrame(dataLength uint64, body []byte) (frame []byte) {
+	data := bytes.NewBuffer(nil)
+	NewBinaryWriter(data).WriteVarint(dataLength)
+	
+	zw := zlib.NewWriter(data)
+	zw.Write(body)
+	zw.Close()
+	
+	buf := bytes.NewBuffer(nil)
+	NewBinaryWriter(buf).WritePacket(data.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadCompressedPacketErrors(t *testing.T) {
+	body := bytes.Repeat([]byte{0x2a}, 100)
+	
+	tests := []struct {
+		name string
+		threshold int
+		frame []byte
+	}{
+		{"data length below threshold", 256, compressedFrame(100, body)},
+		{"data length too long", 64, compressedFrame(101, body)},
+		{"data length too short", 64, compressedFrame(99, body)},
+		{"data length past MaxDataLength", 64, compressedFrame(MaxDataLength + 1, body)},
+		{"data length longer than 5 bytes", 64, mustDecodeHex("06ffffffffff01")},
+		{"not zlib", 64, mustDecodeHex("066401020304")},
+	}
+	
+	for _, test := range tests {
+		r := NewBinaryReader(bytes.NewReader(test.frame))
+		_, err := r.ReadCompressedPacket(test.threshold)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+	
+	// A data length at the threshold is fine.
+	r := NewBinaryReader(bytes.NewReader(compressedFrame(100, body)))
+	packet, err := r.ReadCompressedPacket(100)
+	if err != nil || !bytes.Equal(packet, body) {
+		t.Errorf("Data length at threshold: got %v", err)
+	}
+}
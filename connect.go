@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// ErrSwitchNotSupported is returned by Connect in protocol versions the proxy
+// can't switch servers in.
+var ErrSwitchNotSupported = errors.New("Switching servers is not supported in this protocol version")
+
+// serverSwitch is a connection to a new server that has been logged in to and
+// is waiting to replace the session's current server connection.
+type serverSwitch struct {
+	addr Address
+	conn net.Conn
+	codec *codec
+	joinGame *PC1JoinGamePacket
+}
+
+// Connect moves the player to the server at serverAddr without disconnecting
+// the client. The proxy connects and logs in to the new server as the player
+// in the background, so Connect returns straight away and may be called from
+// a handler. Once logging in succeeds the old server connection is closed and
+// the client is made to reload its world; if it fails, the error is logged and
+// the player stays where they are. Connect can only be used in the Play state,
+// and only in the protocol versions whose Join Game and Respawn packets the
+// proxy knows: 1.7.2 (4), 1.7.10 (5), 1.8 (47) and 1.12.2 (340). In any other
+// version it returns ErrSwitchNotSupported without connecting to the server.
+func (s *Session) Connect(serverAddr Address) (err error) {
+	state, passing := s.passingState()
+	if !passing || state != Play {
+		return fmt.Errorf("Cannot switch servers outside the Play state")
+	}
+	
+	for _, packet := range []Packet{&PC1JoinGamePacket{}, &PC7RespawnPacket{}} {
+		_, err = s.Proxy.registry.ID(packet, s.ProtocolVersion)
+		if err != nil {
+			return ErrSwitchNotSupported
+		}
+	}
+	
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	
+	if s.switching {
+		return fmt.Errorf("Server switch already in progress")
+	}
+	
+	s.switching = true
+	go s.connect(serverAddr)
+	
+	return nil
+}
+
+// connect logs in to a new server for Connect and hands the connection to the
+// packet loop, or closes it if the session has ended in the meantime.
+func (s *Session) connect(serverAddr Address) {
+	sw, err := s.dialServer(serverAddr)
+	
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	
+	if err != nil {
+		log.Printf("Could not switch to %s: %s", serverAddr.String(), err.Error())
+		s.switching = false
+		return
+	}
+	
+	if s.isFinished() {
+		sw.conn.Close()
+		s.switching = false
+		return
+	}
+	
+	// Only one switch is in progress at a time, so this doesn't block.
+	s.switchChan <- sw
+}
+
+// dialServer connects and logs in to a new server, giving up after the proxy's
+// ConnectTimeout if it is not 0.
+func (s *Session) dialServer(serverAddr Address) (sw *serverSwitch, err error) {
+	log.Printf("Connecting to %s", serverAddr.String())
+	
+	timeout := s.Proxy.ConnectTimeout
+	conn, err := net.DialTimeout("tcp", serverAddr.String(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	
+	c := newCodec(conn)
+	
+	joinGame, err := s.loginServer(c, serverAddr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	
+	conn.SetDeadline(time.Time{})
+	
+	sw = &serverSwitch{
+		addr: serverAddr,
+		conn: conn,
+		codec: c,
+		joinGame: joinGame,
+	}
+	
+	return sw, nil
+}
+
+// closeSwitch closes the connection to a server that was logged in to for
+// Connect but not switched to before the packet loop exited.
+func (s *Session) closeSwitch() {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	
+	select {
+	case sw := <-s.switchChan:
+		sw.conn.Close()
+	default:
+	}
+}
+
+// loginServer performs the handshake and login sequence on a new server
+// connection, returning the server's Join Game packet.
+func (s *Session) loginServer(c *codec, serverAddr Address) (joinGame *PC1JoinGamePacket, err error) {
+	err = s.write(c, &HS0HandshakePacket{
+		ProtocolVersion: s.ProtocolVersion,
+		ServerAddress: serverAddr.Host,
+		ServerPort: uint16(serverAddr.Port),
+		NextState: 2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	err = s.write(c, &LS0LoginStartPacket{Name: s.PlayerName})
+	if err != nil {
+		return nil, err
+	}
+	
+	for {
+		packetData, err := c.Read()
+		if err != nil {
+			return nil, err
+		}
+		
+		switch idNum := packetNumber(packetData); idNum {
+		case (&LC1EncryptionRequestPacket{}).ID().Number:
+			_, err = s.encryptServer(c, packetData)
+		
+		case (&LC3SetCompressionPacket{}).ID().Number:
+			packet := &LC3SetCompressionPacket{}
+			err = s.decode(packetData, packet)
+			if err == nil {
+				c.SetCompression(int(packet.Threshold))
+			}
+		
+		case (&LC4LoginPluginRequestPacket{}).ID().Number:
+			// The client can't answer plugin requests once it is in the Play
+			// state, so tell the server we don't understand them.
+			packet := &LC4LoginPluginRequestPacket{}
+			err = s.decode(packetData, packet)
+			if err == nil {
+				err = s.write(c, &LS2LoginPluginResponsePacket{MessageID: packet.MessageID})
+			}
+		
+		case (&LC2LoginSuccessPacket{}).ID().Number:
+			packetData, err = c.Read()
+			if err != nil {
+				return nil, err
+			}
+			
+			joinGame = &PC1JoinGamePacket{}
+			err = s.decode(packetData, joinGame)
+			if err != nil {
+				return nil, err
+			}
+			
+			return joinGame, nil
+		
+		default:
+			err = fmt.Errorf("Unexpected %s packet during login", PacketID{Login, Clientbound, idNum}.String())
+		}
+		
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// switchServer replaces the current server connection with a new one. It is
+// called from the packet loop in passPackets.
+func (s *Session) switchServer(sw *serverSwitch) (err error) {
+	log.Printf("Switching to %s", sw.addr.String())
+	
+	// Respawning into a different dimension and then back into the right one
+	// makes the client throw away the old world.
+	joinGame := sw.joinGame
+	otherDimension := int32(-1)
+	if joinGame.Dimension < 0 {
+		otherDimension = 0
+	}
+	
+	packets := []Packet{
+		joinGame,
+		&PC7RespawnPacket{otherDimension, joinGame.Difficulty, joinGame.Gamemode, joinGame.LevelType},
+		&PC7RespawnPacket{joinGame.Dimension, joinGame.Difficulty, joinGame.Gamemode, joinGame.LevelType},
+	}
+	
+	var packetsData [][]byte
+	for _, packet := range packets {
+		packetData, err := s.encode(packet)
+		if err != nil {
+			return err
+		}
+		
+		packetsData = append(packetsData, packetData)
+	}
+	
+	// The forwarder must not send anything to the server while it is being
+	// replaced, or anything to the client before it has been respawned.
+	s.forwardLock.Lock()
+	
+	// Anything still in flight from the old server is thrown away.
+	s.stopServer()
+	
+	s.connLock.Lock()
+	s.serverConn.Close()
+	s.ServerAddr = sw.addr
+	s.serverConn = sw.conn
+	s.serverCodec = sw.codec
+	s.switching = false
+	s.connLock.Unlock()
+	
+	s.startServer()
+	
+	for _, packetData := range packetsData {
+		s.clientOutgoing <- packetData
+	}
+	
+	s.forwardLock.Unlock()
+	
+	s.Proxy.hm.Fire(s, &ServerConnectEvent{sw.addr})
+	
+	return nil
+}
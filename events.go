@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net"
+)
+
+// Event is implemented by the types describing session lifecycle events. An
+// event handler is a function taking a *Session and a pointer to one of these
+// types, with no return value, registered with Proxy.AddHandler like a packet
+// handler.
+type Event interface {
+	eventName() string
+}
+
+// ConnectEvent is fired when a client connection is accepted.
+type ConnectEvent struct {
+	RemoteAddr net.Addr
+}
+
+func (event *ConnectEvent) eventName() string {
+	return "Connect"
+}
+
+// HandshakeEvent is fired when the client's handshake has been received.
+type HandshakeEvent struct {
+	ProtocolVersion uint64
+	Hostname string
+	NextState State
+}
+
+func (event *HandshakeEvent) eventName() string {
+	return "Handshake"
+}
+
+// ServerConnectEvent is fired when a connection to a server is made, either
+// for a new session or when the session switches servers.
+type ServerConnectEvent struct {
+	ServerAddr Address
+}
+
+func (event *ServerConnectEvent) eventName() string {
+	return "ServerConnect"
+}
+
+// LoginEvent is fired when the player has logged in and is about to enter the
+// Play state.
+type LoginEvent struct {
+	PlayerName string
+	UUID string
+}
+
+func (event *LoginEvent) eventName() string {
+	return "Login"
+}
+
+// StateChangeEvent is fired when the session changes protocol state.
+type StateChangeEvent struct {
+	OldState State
+	NewState State
+}
+
+func (event *StateChangeEvent) eventName() string {
+	return "StateChange"
+}
+
+// CloseEvent is fired when the session has ended. Err is the error that ended
+// it, or nil.
+type CloseEvent struct {
+	Err error
+}
+
+func (event *CloseEvent) eventName() string {
+	return "Close"
+}
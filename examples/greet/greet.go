@@ -3,7 +3,10 @@
 package main
 
 import (
+    "context"
     "github.com/kierdavis/proxy"
+    "github.com/kierdavis/proxy/chat"
+    "github.com/kierdavis/proxy/packets"
     "log"
     "os"
     "strings"
@@ -31,9 +34,13 @@ func main() {
 	
 	// Add any packet handlers to the proxy.
 	prox.AddHandler(chatPacketHandler)
+	prox.AddHandler(chatCommandHandler)
 	
-	// Start the proxy server.
-	err = prox.Run()
+	// Event handlers are added in the same way.
+	prox.AddHandler(loginEventHandler)
+	
+	// Start the proxy server. It runs until the context is cancelled.
+	err = prox.Run(context.Background())
 	if err != nil {
 		log.Printf("Fatal error: %s\n", err.Error())
 		os.Exit(1)
@@ -48,11 +55,13 @@ func main() {
 //     about the packet being processed. It may be modified by the packet
 //     handler.
 // The type of the second argument determines which packets the handler will be
-// triggered for.
+// triggered for. The packets subpackage defines types for the common packets
+// in each supported version of Minecraft, and the proxy picks the right one
+// for each player's protocol version.
 // Packet handlers must return a value of type bool. If this value is true, the
 // modified packet continues on its journey to the server. If it is false, the
 // packet is dropped.
-func chatPacketHandler(session *proxy.Session, packet *PS1ChatMessagePacket) bool {
+func chatPacketHandler(session *proxy.Session, packet *packets.ServerboundChatMessage) bool {
 	// This code will be run whenever the Minecraft client sends a chat message
 	// packet to the server i.e. whenever the player types a chat message and
 	// presses enter.
@@ -60,17 +69,7 @@ func chatPacketHandler(session *proxy.Session, packet *PS1ChatMessagePacket) boo
 	// We will check to see if the player has sent a message beginning with
 	// "/greet".
 	if strings.HasPrefix(packet.Message, "/greet") {
-		// We will then construct a new packet, this one a clientbound chat
-		// message packet. It has a slightly different format to the serverbound
-		// chat packet we just received.
-		newPacket := &PC2ChatMessagePacket{}
-		
-		// The message field in the clientbound chat packet is a JSON string,
-		// unlike the serverbound chat packet.
-		newPacket.JsonData = "{'text':'Hello from the proxy!','color':'red'}"
-		
-		// Send this packet to the client.
-		session.Send(newPacket)
+		greet(session)
 		
 		// Return false so that the original packet never reaches the server (if
 		// it did, the server would not recognise the /greet command and would
@@ -82,68 +81,36 @@ func chatPacketHandler(session *proxy.Session, packet *PS1ChatMessagePacket) boo
 	return true
 }
 
-// We need to define the packet types used in the above handler.
-// In the Minecraft protocol (as of Minecraft version 1.7), each type of packet
-// is identified by three components:
-//   * The "protocol state" - one of Handshaking, Play, Status or Login.
-//   * The direction - whether the packet is serverbound (sent from the client
-//     to the server) or clientbound (sent from the server to the client).
-//   * The number - an integer uniquely identifying the packet type within each
-//     combination of state and direction.
-// http://wiki.vg/Protocol has a comprehensive list of all packet types in the
-// latest version of Minecraft.
-
-// A naming convention used in this package is for packet type names to have the
-// format "<state><direction><number (hexadecimal)><name>Packet", where <state>, <direction>
-// and <number> are the elements of the packet ID and are unique to each type of
-// packet, and <name> is the name of the packet type as specified on the list at
-// http://wiki.vg/Protocol.
-// The reason for prefixing packet type names with characters identifying the ID
-// is to distinguish packets with the same name but different states or
-// directions (for example, the clientbound and serverbound chat messages are
-// different).
-
-// First up, the serverbound Chat Message packet. It contains only one field,
-// which is a string. Its name is prefixed with "PS1", since it is a Play-state
-// packet, it is Serverbound, and within the domain of Play-state serverbound
-// packets it is numbered 1.
-type PS1ChatMessagePacket struct {
-	Message string
-}
-
-// All packet types must define an ID method that returns the packet's ID as a
-// proxy.PacketID value.
-func (packet *PS1ChatMessagePacket) ID() proxy.PacketID {
-	return proxy.PacketID{proxy.Play, proxy.Serverbound, 0x1}
-}
-
-// They must also define a Read method, to read the packet's values from the
-// binary data stream, and a Write method to do the opposite.
-func (packet *PS1ChatMessagePacket) Read(r proxy.BinaryReader) {
-	// The second return value from r.Read*() will always be nil in this
-	// context, so we can ignore it.
-	packet.Message, _ = r.ReadString()
-}
-
-func (packet *PS1ChatMessagePacket) Write(w proxy.BinaryWriter) {
-	w.WriteString(packet.Message)
-}
-
-// We will also define the clientbound Chat Message packet. It is a Play-state,
-// Clientbound packet with number 2, and contains a single string-type field
-// containing the JSON data describing the chat message.
-type PC2ChatMessagePacket struct {
-	JsonData string
-}
-
-func (packet *PC2ChatMessagePacket) ID() proxy.PacketID {
-	return proxy.PacketID{proxy.Play, proxy.Clientbound, 0x2}
+// Since 1.19, commands are sent in their own packet rather than as a chat
+// message, without the leading slash.
+func chatCommandHandler(session *proxy.Session, packet *packets.ChatCommand) bool {
+	if strings.HasPrefix(packet.Command, "greet") {
+		greet(session)
+		return false
+	}
+	
+	return true
 }
 
-func (packet *PC2ChatMessagePacket) Read(r proxy.BinaryReader) {
-	packet.JsonData, _ = r.ReadString()
+func greet(session *proxy.Session) {
+	// We will construct a new packet, this one a clientbound chat message
+	// packet. It has a different format to the serverbound chat packet we just
+	// received: the message is a chat component sent as JSON.
+	newPacket := &packets.ClientboundChatMessage{}
+	newPacket.JsonData = chat.Text("Hello from the proxy!").SetColor(chat.Red).JSON()
+	newPacket.Position = packets.ChatPositionSystem
+	
+	// Send this packet to the client.
+	err := session.Send(newPacket)
+	if err != nil {
+		log.Printf("Could not greet player: %s", err.Error())
+	}
 }
 
-func (packet *PC2ChatMessagePacket) Write(w proxy.BinaryWriter) {
-	w.WriteString(packet.JsonData)
+// An example event handler.
+// Event handlers look like packet handlers, except that the second argument is
+// one of the event types defined by the proxy package (such as
+// *proxy.LoginEvent or *proxy.CloseEvent) and they return nothing.
+func loginEventHandler(session *proxy.Session, event *proxy.LoginEvent) {
+	log.Printf("%s joined the game", event.PlayerName)
 }
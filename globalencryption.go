@@ -2,8 +2,13 @@ package proxy
 
 import (
 	"crypto/rsa"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"sync"
+	"time"
 )
 
 import crand "crypto/rand"
@@ -14,8 +19,23 @@ type globalEncryptionManager struct {
 	privateKey *rsa.PrivateKey
 	encodedPublicKey []byte
 	serverID string
+	
+	// Held while asking the auth servers for a token, so that only one
+	// session does so at a time.
+	authLock sync.Mutex
+	
+	// Guards the fields below. It is not held while talking to the auth
+	// servers, so sessions with a fresh token don't wait for them.
+	sessionLock sync.Mutex
+	session *AuthSession
+	validatedAt time.Time
+	tokenFileLoaded bool
 }
 
+// How long an access token is reused after it was last validated, refreshed or
+// issued before the auth servers are asked about it again.
+const tokenValidationInterval = time.Minute
+
 func newGlobalEncryptionManager(username, password string) (gem *globalEncryptionManager, err error) {
 	log.Printf("Generating keypair")
 	
@@ -50,3 +70,123 @@ func newGlobalEncryptionManager(username, password string) (gem *globalEncryptio
 	
 	return gem, nil
 }
+
+// authenticate returns an access token for the proxy's account. A cached token
+// is reused while it is still valid and refreshed when it is not, so that a
+// password login is only needed if both of these fail. Tokens are only
+// validated once every tokenValidationInterval. If tokenFile is not empty,
+// tokens are loaded from and saved to that file.
+func (gem *globalEncryptionManager) authenticate(auth AuthService, tokenFile string) (session *AuthSession, err error) {
+	session, fresh := gem.cachedSession(tokenFile)
+	if fresh {
+		return session, nil
+	}
+	
+	gem.authLock.Lock()
+	defer gem.authLock.Unlock()
+	
+	// Another session may have got a token while we were waiting.
+	cached, fresh := gem.cachedSession(tokenFile)
+	if fresh {
+		return cached, nil
+	}
+	
+	if cached != nil {
+		err = auth.Validate(cached.AccessToken, cached.ClientToken)
+		if err == nil {
+			return gem.setSession(cached, tokenFile), nil
+		}
+		
+		log.Printf("Refreshing access token")
+		
+		session, err = auth.Refresh(cached.AccessToken, cached.ClientToken)
+		if err == nil {
+			return gem.setSession(session, tokenFile), nil
+		}
+		
+		log.Printf("Could not refresh access token: %s", err.Error())
+	}
+	
+	log.Printf("Logging in as %s", gem.username)
+	
+	clientToken := ""
+	if cached != nil {
+		clientToken = cached.ClientToken
+	}
+	
+	session, err = auth.Authenticate(gem.username, gem.password, clientToken)
+	if err != nil {
+		return nil, err
+	}
+	
+	return gem.setSession(session, tokenFile), nil
+}
+
+// cachedSession returns the cached session, loading it from tokenFile the first
+// time, and whether it was validated recently enough to be used as it is.
+func (gem *globalEncryptionManager) cachedSession(tokenFile string) (session *AuthSession, fresh bool) {
+	gem.sessionLock.Lock()
+	defer gem.sessionLock.Unlock()
+	
+	if gem.session == nil && tokenFile != "" && !gem.tokenFileLoaded {
+		var err error
+		gem.tokenFileLoaded = true
+		gem.session, err = loadTokenFile(tokenFile)
+		if err != nil {
+			log.Printf("Could not load token file: %s", err.Error())
+		}
+	}
+	
+	fresh = gem.session != nil && time.Since(gem.validatedAt) < tokenValidationInterval
+	return gem.session, fresh
+}
+
+// setSession caches a session that has just been validated or issued, saving
+// it to tokenFile if it is new.
+func (gem *globalEncryptionManager) setSession(session *AuthSession, tokenFile string) *AuthSession {
+	gem.sessionLock.Lock()
+	defer gem.sessionLock.Unlock()
+	
+	gem.validatedAt = time.Now()
+	if session == gem.session {
+		return session
+	}
+	
+	gem.session = session
+	
+	if tokenFile != "" {
+		err := saveTokenFile(tokenFile, session)
+		if err != nil {
+			log.Printf("Could not save token file: %s", err.Error())
+		}
+	}
+	
+	return session
+}
+
+func loadTokenFile(filename string) (session *AuthSession, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	session = &AuthSession{}
+	err = json.Unmarshal(data, session)
+	if err != nil {
+		return nil, err
+	}
+	
+	return session, nil
+}
+
+func saveTokenFile(filename string, session *AuthSession) (err error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	
+	return ioutil.WriteFile(filename, data, 0600)
+}
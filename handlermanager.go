@@ -1,19 +1,29 @@
 package proxy
 
 import (
+	"fmt"
 	"log"
 	"reflect"
 )
 
+var eventType = reflect.TypeOf((*Event)(nil)).Elem()
+
 type handlerManager struct {
-	types map[PacketID]reflect.Type
-	handlers map[PacketID][]reflect.Value
+	registry *Registry
+	handlers map[reflect.Type][]reflect.Value
+	eventHandlers map[reflect.Type][]reflect.Value
+	rawHandlers map[PacketID][]RawHandler
+	rawStateHandlers map[rawHandlerKey][]RawHandler
+	rawGlobalHandlers []RawHandler
 }
 
-func newHandlerManager() (hm *handlerManager) {
+func newHandlerManager(registry *Registry) (hm *handlerManager) {
 	return &handlerManager{
-		types: make(map[PacketID]reflect.Type),
-		handlers: make(map[PacketID][]reflect.Value),
+		registry: registry,
+		handlers: make(map[reflect.Type][]reflect.Value),
+		eventHandlers: make(map[reflect.Type][]reflect.Value),
+		rawHandlers: make(map[PacketID][]RawHandler),
+		rawStateHandlers: make(map[rawHandlerKey][]RawHandler),
 	}
 }
 
@@ -21,20 +31,87 @@ func (hm *handlerManager) Add(handler interface{}) {
 	// error checking!!!
 	
 	v := reflect.ValueOf(handler)
+	
+	if v.Type().In(1).Implements(eventType) {
+		t := v.Type().In(1)
+		hm.eventHandlers[t] = append(hm.eventHandlers[t], v)
+		
+		log.Printf("Registered handler for %s events", reflect.Zero(t).Interface().(Event).eventName())
+		return
+	}
+	
 	packetType := v.Type().In(1).Elem()
-	id := reflect.New(packetType).Interface().(Packet).ID()
+	checkHandledState("Add", newPacket(packetType).ID().State)
+	hm.registry.Add(newPacket(packetType))
+	hm.handlers[packetType] = append(hm.handlers[packetType], v)
+	
+	log.Printf("Registered handler for %s", packetType.String())
+}
+
+func (hm *handlerManager) AddRaw(id PacketID, handler RawHandler) {
+	checkHandledState("AddRaw", id.State)
+	hm.rawHandlers[id] = append(hm.rawHandlers[id], handler)
+	log.Printf("Registered raw handler for %s", id.String())
+}
+
+func (hm *handlerManager) AddRawState(state State, dir Direction, handler RawHandler) {
+	checkHandledState("AddRawState", state)
+	key := rawHandlerKey{state, dir}
+	hm.rawStateHandlers[key] = append(hm.rawStateHandlers[key], handler)
+	log.Printf("Registered raw handler for %s:%s", state.String(), dir.String())
+}
+
+func (hm *handlerManager) AddRawGlobal(handler RawHandler) {
+	hm.rawGlobalHandlers = append(hm.rawGlobalHandlers, handler)
+	log.Printf("Registered raw handler for all packets")
+}
+
+// checkHandledState panics if handlers can't be added for packets in the
+// state. The Handshaking and Login packets are handled by the session itself
+// and never reach handlers.
+func checkHandledState(method string, state State) {
+	if state != Status && state != Play {
+		panic(fmt.Sprintf("handlerManager.%s: packets in state %s are not passed to handlers", method, state.String()))
+	}
+}
+
+func (hm *handlerManager) HasRaw(id PacketID) bool {
+	return len(hm.rawGlobalHandlers) > 0 || len(hm.rawStateHandlers[rawHandlerKey{id.State, id.Direction}]) > 0 || len(hm.rawHandlers[id]) > 0
+}
+
+// ProcessRaw calls the raw handlers matching the packet, from the most general
+// to the most specific.
+func (hm *handlerManager) ProcessRaw(session *Session, packet *RawPacket) (accept bool) {
+	id := packet.PacketID
+	
+	defer func() {
+		if x := recover(); x != nil {
+			log.Printf("Panic caught when handling raw %s packet: %v", id.String(), x)
+		}
+	}()
+	
+	accept = true
 	
-	hm.types[id] = packetType
-	hm.handlers[id] = append(hm.handlers[id], v)
+	handlers := append([]RawHandler(nil), hm.rawGlobalHandlers...)
+	handlers = append(handlers, hm.rawStateHandlers[rawHandlerKey{id.State, id.Direction}]...)
+	handlers = append(handlers, hm.rawHandlers[id]...)
 	
-	log.Printf("Registered handler for %s", id.String())
+	for _, handler := range handlers {
+		accept = handler(session, packet) && accept
+	}
+	
+	return accept
 }
 
-func (hm *handlerManager) Lookup(id PacketID) (packet Packet) {
-	t, ok := hm.types[id]
-	if ok {
-		return reflect.New(t).Interface().(Packet)
+// Lookup returns a new packet of the type with handlers that has the given ID
+// in a protocol version, or nil if there is none.
+func (hm *handlerManager) Lookup(id PacketID, version uint64) (packet Packet) {
+	for _, t := range hm.registry.lookupTypes(version, id) {
+		if len(hm.handlers[t]) > 0 {
+			return newPacket(t)
+		}
 	}
+	
 	return nil
 }
 
@@ -48,8 +125,8 @@ func (hm *handlerManager) Process(session *Session, packet Packet) (accept bool)
 	accept = true
 	
 	s := reflect.ValueOf(session)
-	v := reflect.ValueOf(packet)
-	handlers := hm.handlers[packet.ID()]
+	v := reflect.ValueOf(packetValue(packet))
+	handlers := hm.handlers[v.Type().Elem()]
 	
 	for _, handler := range handlers {
 		ins := []reflect.Value{s, v}
@@ -61,3 +138,20 @@ func (hm *handlerManager) Process(session *Session, packet Packet) (accept bool)
 	
 	return accept
 }
+
+func (hm *handlerManager) Fire(session *Session, event Event) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Printf("Panic caught when handling %s event: %v", event.eventName(), x)
+		}
+	}()
+	
+	s := reflect.ValueOf(session)
+	v := reflect.ValueOf(event)
+	handlers := hm.eventHandlers[v.Type()]
+	
+	for _, handler := range handlers {
+		ins := []reflect.Value{s, v}
+		handler.Call(ins)
+	}
+}
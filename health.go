@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ServerHealth is the result of the latest health check of a server.
+type ServerHealth struct {
+	Up bool
+	
+	// When the check was made, and why it failed if the server is down.
+	Checked time.Time
+	Err error
+	
+	// How long the server took to answer.
+	Latency time.Duration
+}
+
+// ServerUp reports whether the latest health check of a server found it to be
+// up. Servers that haven't been checked are assumed to be up.
+func (proxy *Proxy) ServerUp(serverAddr Address) (up bool) {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	
+	health, ok := proxy.health[serverAddr]
+	return !ok || health.Up
+}
+
+// Health returns the results of the latest health check of each server that
+// can be routed to.
+func (proxy *Proxy) Health() (health map[Address]ServerHealth) {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	
+	health = make(map[Address]ServerHealth, len(proxy.health))
+	for addr, h := range proxy.health {
+		health[addr] = h
+	}
+	
+	return health
+}
+
+// checkHealth checks the servers every HealthCheckInterval until stop is
+// closed.
+func (proxy *Proxy) checkHealth(stop chan struct{}) {
+	if proxy.HealthCheckInterval <= 0 {
+		return
+	}
+	
+	ticker := time.NewTicker(proxy.HealthCheckInterval)
+	defer ticker.Stop()
+	
+	for {
+		proxy.checkServers()
+		
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkServers pings every server that can be routed to at the same time and
+// records which of them answered.
+func (proxy *Proxy) checkServers() {
+	servers := proxy.router.Servers()
+	results := make([]ServerHealth, len(servers))
+	
+	var wg sync.WaitGroup
+	for i, addr := range servers {
+		wg.Add(1)
+		go func(i int, addr Address) {
+			defer wg.Done()
+			
+			start := time.Now()
+			jsonData, err := pingServer(proxy.registry, addr, proxy.HealthCheckTimeout)
+			results[i] = ServerHealth{err == nil, start, err, time.Since(start)}
+			
+			if err == nil {
+				proxy.cacheStatus(addr, jsonData)
+			}
+		}(i, addr)
+	}
+	wg.Wait()
+	
+	health := make(map[Address]ServerHealth, len(servers))
+	
+	proxy.lock.Lock()
+	for i, addr := range servers {
+		old, checked := proxy.health[addr]
+		h := results[i]
+		
+		if h.Up && checked && !old.Up {
+			log.Printf("Server %s is up", addr.String())
+		} else if !h.Up && (!checked || old.Up) {
+			log.Printf("Server %s is down: %s", addr.String(), h.Err.Error())
+		}
+		
+		health[addr] = h
+	}
+	proxy.health = health
+	proxy.lock.Unlock()
+}
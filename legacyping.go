@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kierdavis/proxy/chat"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// isLegacyPing reports whether the client has started a server list ping from
+// before 1.7, which begins with 0xFE rather than a packet length.
+func (s *Session) isLegacyPing() (ok bool) {
+	buf, err := s.clientCodec.bufr.Peek(1)
+	return err == nil && buf[0] == 0xFE
+}
+
+// answerLegacyPing answers a server list ping from before 1.7. Beta 1.8 to 1.3
+// clients send only 0xFE, 1.4 and 1.5 clients follow it with 0x01, and 1.6
+// clients then send an MC|PingHost plugin message giving the hostname they
+// connected with. As in the server, the forms are told apart by how much the
+// client has sent.
+func (s *Session) answerLegacyPing() (err error) {
+	r := s.clientCodec.bufr
+	_, err = r.ReadByte()
+	if err != nil {
+		return err
+	}
+	
+	beta := r.Buffered() == 0
+	hostname := ""
+	
+	if !beta {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0x01 {
+			return fmt.Errorf("Invalid legacy ping")
+		}
+		
+		if r.Buffered() > 0 {
+			hostname, err = s.readPingHost()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	
+	log.Printf("Legacy ping for %q", hostname)
+	
+	s.ProtocolVersion = statusQueryVersion
+	s.Hostname = normaliseHostname(hostname)
+	
+	var status *ServerStatus
+	if s.Proxy.StatusProvider != nil {
+		status, err = s.localStatus()
+	} else {
+		status, err = s.queryStatus()
+		if err != nil {
+			log.Printf("Could not get status: %s", err.Error())
+			status, err = s.offlineStatus()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	
+	if s.Proxy.StatusHandler != nil {
+		s.Proxy.StatusHandler(s, status)
+	}
+	
+	description := status.Description
+	if description == nil {
+		description = chat.Text("")
+	}
+	
+	sep := string(chat.SectionSign)
+	
+	var response string
+	if beta {
+		// The fields are separated by section signs, so the message of the
+		// day can't be formatted.
+		motd := chat.ParseLegacy(description.Legacy()).Plain()
+		motd = strings.Replace(motd, sep, "", -1)
+		response = strings.Join([]string{
+			motd,
+			strconv.Itoa(status.Players.Online),
+			strconv.Itoa(status.Players.Max),
+		}, sep)
+	} else {
+		response = strings.Join([]string{
+			sep + "1",
+			strconv.Itoa(status.Version.Protocol),
+			status.Version.Name,
+			description.Legacy(),
+			strconv.Itoa(status.Players.Online),
+			strconv.Itoa(status.Players.Max),
+		}, "\x00")
+	}
+	
+	return s.writeLegacyKick(response)
+}
+
+// readPingHost reads the MC|PingHost plugin message sent by 1.6 clients after
+// 0xFE 0x01 and returns the hostname in it.
+func (s *Session) readPingHost() (hostname string, err error) {
+	br := s.clientCodec.binr
+	
+	id, err := br.ReadUint8()
+	if err != nil {
+		return "", err
+	}
+	if id != 0xFA {
+		return "", fmt.Errorf("Invalid legacy ping: expected plugin message, got packet 0x%02X", id)
+	}
+	
+	channel, err := readLegacyString(br, 20)
+	if err != nil {
+		return "", err
+	}
+	if channel != "MC|PingHost" {
+		return "", fmt.Errorf("Invalid legacy ping: unexpected plugin channel %q", channel)
+	}
+	
+	length, err := br.ReadUint16()
+	if err != nil {
+		return "", err
+	}
+	
+	data, err := br.ReadBytes(int(length))
+	if err != nil {
+		return "", err
+	}
+	
+	// Protocol version, hostname and port.
+	dr := NewBinaryReader(bytes.NewReader(data))
+	_, err = dr.ReadUint8()
+	if err != nil {
+		return "", err
+	}
+	
+	return readLegacyString(dr, 255)
+}
+
+// queryStatus asks the server the client would be sent to for its status, as
+// a client would.
+func (s *Session) queryStatus() (status *ServerStatus, err error) {
+	serverAddrs, ok := s.Proxy.router.Lookup(s.Hostname)
+	if !ok {
+		return nil, fmt.Errorf("No route for hostname %q", s.Hostname)
+	}
+	
+	s.ServerAddr = serverAddrs[0]
+	
+	err = s.connectAny(serverAddrs)
+	if err != nil {
+		return nil, err
+	}
+	
+	err = s.send(&HS0HandshakePacket{s.ProtocolVersion, s.ServerAddr.Host, uint16(s.ServerAddr.Port), 1})
+	if err != nil {
+		return nil, err
+	}
+	
+	s.setState(Status)
+	
+	err = s.send(&SS0StatusRequestPacket{})
+	if err != nil {
+		return nil, err
+	}
+	
+	response := &SC0StatusResponsePacket{}
+	err = s.recv(response)
+	if err != nil {
+		return nil, err
+	}
+	
+	s.Proxy.cacheStatus(s.ServerAddr, response.JsonData)
+	
+	return ParseServerStatus(response.JsonData)
+}
+
+// writeLegacyKick sends a legacy kick packet, which is how the response to a
+// legacy ping is sent.
+func (s *Session) writeLegacyKick(message string) (err error) {
+	units := utf16.Encode([]rune(message))
+	if len(units) > 0xFFFF {
+		return fmt.Errorf("Legacy kick message too long (%d characters)", len(units))
+	}
+	
+	bw := s.clientCodec.binw
+	err = bw.WriteUint8(0xFF)
+	if err == nil {
+		err = bw.WriteUint16(uint16(len(units)))
+	}
+	for _, u := range units {
+		if err != nil {
+			break
+		}
+		err = bw.WriteUint16(u)
+	}
+	if err != nil {
+		return err
+	}
+	
+	return s.clientCodec.bufw.Flush()
+}
+
+// readLegacyString reads a string as sent before 1.7: a length in UTF-16 code
+// units followed by that many big-endian code units.
+func readLegacyString(br BinaryReader, max int) (s string, err error) {
+	length, err := br.ReadUint16()
+	if err != nil {
+		return "", err
+	}
+	if int(length) > max {
+		return "", fmt.Errorf("Legacy string too long (%d > %d characters)", length, max)
+	}
+	
+	units := make([]uint16, length)
+	for i := range units {
+		units[i], err = br.ReadUint16()
+		if err != nil {
+			return "", err
+		}
+	}
+	
+	return string(utf16.Decode(units)), nil
+}
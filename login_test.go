@@ -0,0 +1,491 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+import crand "crypto/rand"
+
+const testVersion = 47
+
+const (
+	proxyUsername = "proxy@example.com"
+	proxyPassword = "proxy password"
+	playerUsername = "alice@example.com"
+	playerPassword = "alice password"
+)
+
+var (
+	proxyProfile = Profile{ID: "0b4c3f1e9e0a4d3c8a2f6b1d7e5c4a39", Name: "ProxyBot"}
+	playerProfile = Profile{ID: "9f1e2d3c4b5a46978877665544332211", Name: "alice"}
+	playerUUID = "9f1e2d3c-4b5a-4697-8877-665544332211"
+)
+
+func testWrite(c *codec, packet Packet) (err error) {
+	packetData, err := NewRegistry().encode(packet, testVersion)
+	if err != nil {
+		return err
+	}
+	
+	return c.Write(packetData)
+}
+
+func testRead(c *codec, packet Packet) (err error) {
+	packetData, err := c.Read()
+	if err != nil {
+		return err
+	}
+	
+	return NewRegistry().decode(packetData, packet, testVersion)
+}
+
+func newTestAuthService() (auth *MemoryAuthService) {
+	auth = NewMemoryAuthService()
+	auth.AddAccount(proxyUsername, proxyPassword, proxyProfile)
+	auth.AddAccount(playerUsername, playerPassword, playerProfile)
+	return auth
+}
+
+// startOnlineServer starts a server that accepts one connection and logs it in
+// the way an online-mode server does, checking with auth that the proxy's
+// account has joined. Once logged in, it echoes packets back. The error from
+// logging in is sent on the returned channel.
+func startOnlineServer(t *testing.T, auth AuthService) (serverAddr Address, errs chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	errs = make(chan error, 1)
+	
+	go func() {
+		defer ln.Close()
+		
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		
+		c := newCodec(conn)
+		err = loginOnlineClient(c, auth)
+		errs <- err
+		if err != nil {
+			return
+		}
+		
+		for {
+			packetData, err := c.Read()
+			if err != nil {
+				return
+			}
+			
+			c.Write(packetData)
+		}
+	}()
+	
+	tcpAddr := ln.Addr().(*net.TCPAddr)
+	return Address{"127.0.0.1", tcpAddr.Port}, errs
+}
+
+func loginOnlineClient(c *codec, auth AuthService) (err error) {
+	privateKey, err := rsa.GenerateKey(crand.Reader, 1024)
+	if err != nil {
+		return err
+	}
+	
+	encodedPublicKey, err := encodePublicKey(privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	
+	err = testRead(c, &HS0HandshakePacket{})
+	if err != nil {
+		return err
+	}
+	
+	loginStart := &LS0LoginStartPacket{}
+	err = testRead(c, loginStart)
+	if err != nil {
+		return err
+	}
+	
+	verifyToken := []byte{1, 2, 3, 4}
+	err = testWrite(c, &LC1EncryptionRequestPacket{ServerID: "", PublicKey: encodedPublicKey, VerifyToken: verifyToken})
+	if err != nil {
+		return err
+	}
+	
+	response := &LS1EncryptionResponsePacket{}
+	err = testRead(c, response)
+	if err != nil {
+		return err
+	}
+	
+	sharedSecret, err := rsa.DecryptPKCS1v15(crand.Reader, privateKey, response.EncryptedSharedSecret)
+	if err != nil {
+		return err
+	}
+	
+	returnedVerifyToken, err := rsa.DecryptPKCS1v15(crand.Reader, privateKey, response.EncryptedVerifyToken)
+	if err != nil {
+		return err
+	}
+	
+	if !bytes.Equal(returnedVerifyToken, verifyToken) {
+		return fmt.Errorf("Verify token mismatch")
+	}
+	
+	_, err = auth.HasJoined(proxyProfile.Name, AuthDigest("", sharedSecret, encodedPublicKey))
+	if err != nil {
+		return err
+	}
+	
+	err = c.Encrypt(sharedSecret)
+	if err != nil {
+		return err
+	}
+	
+	return testWrite(c, &LC2LoginSuccessPacket{UUID: playerUUID, Username: loginStart.Name})
+}
+
+// dialTestProxy connects a client to p.
+func dialTestProxy(t *testing.T, p *Proxy) (c *codec) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	
+	go func() {
+		proxyConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		
+		if p.addSession() {
+			p.handleConnection(proxyConn)
+		}
+	}()
+	
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+	return newCodec(clientConn)
+}
+
+// loginThroughProxy logs in to the proxy as the player, answering its
+// encryption request. The player joins the session with auth first if join is
+// true.
+func loginThroughProxy(c *codec, auth AuthService, join bool) (err error) {
+	err = testWrite(c, &HS0HandshakePacket{testVersion, "localhost", 25565, 2})
+	if err != nil {
+		return err
+	}
+	
+	err = testWrite(c, &LS0LoginStartPacket{Name: playerProfile.Name})
+	if err != nil {
+		return err
+	}
+	
+	request := &LC1EncryptionRequestPacket{}
+	err = testRead(c, request)
+	if err != nil {
+		return err
+	}
+	
+	publicKey, err := decodePublicKey(request.PublicKey)
+	if err != nil {
+		return err
+	}
+	
+	sharedSecret := make([]byte, 16)
+	_, err = io.ReadFull(crand.Reader, sharedSecret)
+	if err != nil {
+		return err
+	}
+	
+	if join {
+		session, err := auth.Authenticate(playerUsername, playerPassword, "")
+		if err != nil {
+			return err
+		}
+		
+		err = auth.Join(session.AccessToken, session.Profile.ID, AuthDigest(request.ServerID, sharedSecret, request.PublicKey))
+		if err != nil {
+			return err
+		}
+	}
+	
+	encryptedSharedSecret, err := rsa.EncryptPKCS1v15(crand.Reader, &publicKey, sharedSecret)
+	if err != nil {
+		return err
+	}
+	
+	encryptedVerifyToken, err := rsa.EncryptPKCS1v15(crand.Reader, &publicKey, request.VerifyToken)
+	if err != nil {
+		return err
+	}
+	
+	err = testWrite(c, &LS1EncryptionResponsePacket{EncryptedSharedSecret: encryptedSharedSecret, EncryptedVerifyToken: encryptedVerifyToken})
+	if err != nil {
+		return err
+	}
+	
+	return c.Encrypt(sharedSecret)
+}
+
+func newOnlineTestProxy(t *testing.T, serverAddr Address, auth AuthService) (p *Proxy) {
+	p, err := New(Address{"127.0.0.1", 0}, serverAddr, proxyUsername, proxyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	p.AuthService = auth
+	p.OnlineMode = true
+	return p
+}
+
+func TestOnlineModeLogin(t *testing.T) {
+	auth := newTestAuthService()
+	serverAddr, serverErrs := startOnlineServer(t, auth)
+	p := newOnlineTestProxy(t, serverAddr, auth)
+	
+	loginEvents := make(chan *LoginEvent, 1)
+	p.AddHandler(func(s *Session, event *LoginEvent) {
+		loginEvents <- event
+	})
+	
+	c := dialTestProxy(t, p)
+	
+	err := loginThroughProxy(c, auth, true)
+	if err != nil {
+		t.Fatalf("Client login failed: %s", err.Error())
+	}
+	
+	err = <-serverErrs
+	if err != nil {
+		t.Fatalf("Server login failed: %s", err.Error())
+	}
+	
+	loginSuccess := &LC2LoginSuccessPacket{}
+	err = testRead(c, loginSuccess)
+	if err != nil {
+		t.Fatalf("Reading Login Success failed: %s", err.Error())
+	}
+	
+	if loginSuccess.UUID != playerUUID || loginSuccess.Username != playerProfile.Name {
+		t.Errorf("Got Login Success %+v", loginSuccess)
+	}
+	
+	event := <-loginEvents
+	if event.UUID != playerUUID || event.PlayerName != playerProfile.Name {
+		t.Errorf("Got login event %+v", event)
+	}
+	
+	// Both connections are encrypted with their own secrets by now, so a
+	// packet only comes back intact if the proxy got both right.
+	packet := &RawPacket{PacketID{Play, Serverbound, 0x01}, []byte("\x05hello")}
+	err = testWrite(c, packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	packetData, err := c.Read()
+	if err != nil {
+		t.Fatalf("Reading echoed packet failed: %s", err.Error())
+	}
+	
+	if !bytes.Equal(packetData, []byte("\x01\x05hello")) {
+		t.Errorf("Got echoed packet %q", packetData)
+	}
+}
+
+// startSilentServer starts a server that accepts one connection and sends the
+// number of bytes it reads from it on the returned channel once it is closed.
+func startSilentServer(t *testing.T) (serverAddr Address, received chan int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	received = make(chan int, 1)
+	
+	go func() {
+		defer ln.Close()
+		
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- 0
+			return
+		}
+		defer conn.Close()
+		
+		n, _ := io.Copy(ioutil.Discard, conn)
+		received <- int(n)
+	}()
+	
+	tcpAddr := ln.Addr().(*net.TCPAddr)
+	return Address{"127.0.0.1", tcpAddr.Port}, received
+}
+
+func TestOnlineModeLoginWithoutJoining(t *testing.T) {
+	auth := newTestAuthService()
+	serverAddr, received := startSilentServer(t)
+	p := newOnlineTestProxy(t, serverAddr, auth)
+	
+	loggedIn := make(chan struct{}, 1)
+	p.AddHandler(func(s *Session, event *LoginEvent) {
+		loggedIn <- struct{}{}
+	})
+	
+	c := dialTestProxy(t, p)
+	
+	err := loginThroughProxy(c, auth, false)
+	if err != nil {
+		t.Fatalf("Client login failed: %s", err.Error())
+	}
+	
+	// The proxy should refuse the player, as the session server has not seen
+	// them join.
+	for err == nil {
+		_, err = c.Read()
+	}
+	
+	select {
+	case <-loggedIn:
+		t.Errorf("Player logged in without joining")
+	default:
+	}
+	
+	// Nothing should have reached the server for a player that failed to
+	// authenticate, not even the handshake.
+	select {
+	case n := <-received:
+		if n != 0 {
+			t.Errorf("Server received %d bytes", n)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Server connection was not closed")
+	}
+}
+
+func TestSignedEncryptionResponse(t *testing.T) {
+	gem, err := newGlobalEncryptionManager(proxyUsername, proxyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	playerPrivateKey, err := rsa.GenerateKey(crand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	playerPublicKey, err := x509.MarshalPKIXPublicKey(&playerPrivateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	validKey := &LoginKey{ExpiresAt: now + 3600000, PublicKey: playerPublicKey}
+	expiredKey := &LoginKey{ExpiresAt: now - 3600000, PublicKey: playerPublicKey}
+	
+	sign := func(verifyToken []byte, salt int64) (signature []byte) {
+		data := make([]byte, len(verifyToken) + 8)
+		copy(data, verifyToken)
+		binary.BigEndian.PutUint64(data[len(verifyToken):], uint64(salt))
+		
+		hash := sha256.Sum256(data)
+		signature, err := rsa.SignPKCS1v15(crand.Reader, playerPrivateKey, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		return signature
+	}
+	
+	tests := []struct {
+		name string
+		key *LoginKey
+		signedSalt int64
+		sentSalt int64
+		ok bool
+	}{
+		{"valid", validKey, 12345, 12345, true},
+		{"negative salt", validKey, -1, -1, true},
+		{"wrong salt", validKey, 12345, 54321, false},
+		{"expired key", expiredKey, 12345, 12345, false},
+		{"no key", nil, 12345, 12345, false},
+	}
+	
+	for _, test := range tests {
+		cem, err := gem.newClient(playerProfile.Name, test.key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		sharedSecret := make([]byte, 16)
+		encryptedSharedSecret, err := rsa.EncryptPKCS1v15(crand.Reader, &gem.privateKey.PublicKey, sharedSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		packet := &LS1EncryptionResponsePacket{
+			EncryptedSharedSecret: encryptedSharedSecret,
+			Salt: test.sentSalt,
+			Signature: sign(cem.verifyToken, test.signedSalt),
+		}
+		
+		err = cem.handleEncryptionResponse(packet)
+		if test.ok && err != nil {
+			t.Errorf("%s: got error %s", test.name, err.Error())
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestUnsupportedVersionRefused(t *testing.T) {
+	p, err := New(Address{"127.0.0.1", 0}, Address{"127.0.0.1", 1}, proxyUsername, proxyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	c := dialTestProxy(t, p)
+	
+	// 1.9.4 is not one of the supported versions.
+	err = testWrite(c, &HS0HandshakePacket{110, "localhost", 25565, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	err = testWrite(c, &LS0LoginStartPacket{Name: playerProfile.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	packet := &LC0DisconnectPacket{}
+	err = testRead(c, packet)
+	if err != nil {
+		t.Fatalf("Reading Disconnect failed: %s", err.Error())
+	}
+	
+	if packet.JsonData != p.UnsupportedVersionMessage.JSON() {
+		t.Errorf("Got Disconnect %s", packet.JsonData)
+	}
+}
@@ -0,0 +1,668 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Marshal writes the exported fields of the struct pointed to by v, in order.
+// Each field is encoded according to its type and its mc tag, which is a
+// comma-separated list of options:
+//
+//   mc:"varint"          an integer sent as a varint
+//   mc:"string,max=256"  a string of at most 256 characters ("string" is
+//                        optional; max also limits the length of slices)
+//   mc:"prefixed=uint16" a string or slice whose length is sent as a uint8,
+//                        uint16, int16, uint32, int32 or varint (the default)
+//   mc:"optional"        a pointer, sent after a bool saying whether it is nil
+//   mc:"rest"            a []byte taking up the rest of the packet
+//   mc:"-"               a field that is not sent
+//
+// Untagged bools are sent as a byte, fixed size integers and floats
+// big-endian, strings and slices prefixed with their length, arrays without a
+// prefix and structs field by field. The options of a slice's tag other than
+// prefixed, max and optional apply to its elements.
+func Marshal(w BinaryWriter, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot marshal %T: not a pointer to a struct", v)
+	}
+	
+	return marshalStruct(w, rv.Elem())
+}
+
+// Unmarshal reads the fields of the struct pointed to by v, as written by
+// Marshal.
+func Unmarshal(r BinaryReader, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot unmarshal %T: not a pointer to a struct", v)
+	}
+	
+	return unmarshalStruct(r, rv.Elem())
+}
+
+type mcTag struct {
+	skip bool
+	varint bool
+	optional bool
+	rest bool
+	prefix string
+	max int
+}
+
+func parseTag(tag string) (t mcTag, err error) {
+	if tag == "-" {
+		t.skip = true
+		return t, nil
+	}
+	
+	for _, opt := range strings.Split(tag, ",") {
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+		
+		switch key {
+		case "", "string":
+		case "varint":
+			t.varint = true
+		case "optional":
+			t.optional = true
+		case "rest":
+			t.rest = true
+		case "prefixed":
+			switch value {
+			case "uint8", "uint16", "int16", "uint32", "int32", "varint":
+				t.prefix = value
+			default:
+				return t, fmt.Errorf("Unknown length prefix type %q", value)
+			}
+		case "max":
+			t.max, err = strconv.Atoi(value)
+			if err != nil || t.max < 0 {
+				return t, fmt.Errorf("Invalid max %q", value)
+			}
+		default:
+			return t, fmt.Errorf("Unknown mc tag option %q", key)
+		}
+	}
+	
+	return t, nil
+}
+
+// elemTag returns the tag used for the elements of a slice or array.
+func (t mcTag) elemTag() mcTag {
+	return mcTag{varint: t.varint}
+}
+
+type structField struct {
+	index int
+	name string
+	tag mcTag
+}
+
+var structFieldsLock sync.RWMutex
+var structFieldsCache = make(map[reflect.Type][]structField)
+
+// structFields returns the fields of a struct type that are sent, with their
+// parsed tags.
+func structFields(t reflect.Type) (fields []structField, err error) {
+	structFieldsLock.RLock()
+	fields, ok := structFieldsCache[t]
+	structFieldsLock.RUnlock()
+	
+	if ok {
+		return fields, nil
+	}
+	
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		
+		tag, err := parseTag(f.Tag.Get("mc"))
+		if err != nil {
+			return nil, fmt.Errorf("Field %s of %s: %s", f.Name, t.String(), err.Error())
+		}
+		
+		if !tag.skip {
+			fields = append(fields, structField{i, f.Name, tag})
+		}
+	}
+	
+	structFieldsLock.Lock()
+	structFieldsCache[t] = fields
+	structFieldsLock.Unlock()
+	
+	return fields, nil
+}
+
+func marshalStruct(w BinaryWriter, v reflect.Value) (err error) {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	
+	for _, f := range fields {
+		err = marshalValue(w, v.Field(f.index), f.tag)
+		if err != nil {
+			return fmt.Errorf("Error encoding field %s: %s", f.name, err.Error())
+		}
+	}
+	
+	return nil
+}
+
+func marshalValue(w BinaryWriter, v reflect.Value, tag mcTag) (err error) {
+	if tag.optional {
+		if v.Kind() != reflect.Ptr {
+			return fmt.Errorf("Optional field of type %s is not a pointer", v.Type().String())
+		}
+		
+		err = w.WriteBool(!v.IsNil())
+		if err != nil || v.IsNil() {
+			return err
+		}
+		
+		tag.optional = false
+	}
+	
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Errorf("Nil pointer")
+		}
+		return marshalValue(w, v.Elem(), tag)
+	
+	case reflect.Bool:
+		return w.WriteBool(v.Bool())
+	
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		if tag.varint {
+			if v.Kind() == reflect.Int64 {
+				return w.WriteVarint64(v.Int())
+			}
+			return w.WriteVarint32(int32(v.Int()))
+		}
+		
+		switch v.Kind() {
+		case reflect.Int8:
+			return w.WriteInt8(int8(v.Int()))
+		case reflect.Int16:
+			return w.WriteInt16(int16(v.Int()))
+		case reflect.Int32:
+			return w.WriteInt32(int32(v.Int()))
+		case reflect.Int64:
+			return w.WriteInt64(v.Int())
+		}
+	
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		if tag.varint {
+			return w.WriteVarint(v.Uint())
+		}
+		
+		switch v.Kind() {
+		case reflect.Uint8:
+			return w.WriteUint8(uint8(v.Uint()))
+		case reflect.Uint16:
+			return w.WriteUint16(uint16(v.Uint()))
+		case reflect.Uint32:
+			return w.WriteUint32(uint32(v.Uint()))
+		case reflect.Uint64:
+			return w.WriteUint64(v.Uint())
+		}
+	
+	case reflect.Float32:
+		return w.WriteFloat32(float32(v.Float()))
+	
+	case reflect.Float64:
+		return w.WriteFloat64(v.Float())
+	
+	case reflect.String:
+		s := v.String()
+		if tag.max > 0 && utf8.RuneCountInString(s) > tag.max {
+			return fmt.Errorf("String length %d exceeds maximum of %d", utf8.RuneCountInString(s), tag.max)
+		}
+		
+		err = writeLength(w, tag.prefix, len(s))
+		if err != nil {
+			return err
+		}
+		
+		return w.WriteBytes([]byte(s))
+	
+	case reflect.Slice:
+		if tag.max > 0 && v.Len() > tag.max {
+			return fmt.Errorf("Array length %d exceeds maximum of %d", v.Len(), tag.max)
+		}
+		
+		if !tag.rest {
+			err = writeLength(w, tag.prefix, v.Len())
+			if err != nil {
+				return err
+			}
+		}
+		
+		return marshalElems(w, v, tag.elemTag())
+	
+	case reflect.Array:
+		return marshalElems(w, v, tag.elemTag())
+	
+	case reflect.Struct:
+		return marshalStruct(w, v)
+	}
+	
+	return fmt.Errorf("Cannot marshal value of type %s", v.Type().String())
+}
+
+func marshalElems(w BinaryWriter, v reflect.Value, tag mcTag) (err error) {
+	if v.Type().Elem().Kind() == reflect.Uint8 && !tag.varint {
+		buf := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(buf), v)
+		return w.WriteBytes(buf)
+	}
+	
+	for i := 0; i < v.Len(); i++ {
+		err = marshalValue(w, v.Index(i), tag)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+func unmarshalStruct(r BinaryReader, v reflect.Value) (err error) {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+	
+	for _, f := range fields {
+		err = unmarshalValue(r, v.Field(f.index), f.tag)
+		if err != nil {
+			return fieldError(f.name, err)
+		}
+	}
+	
+	return nil
+}
+
+// fieldError is FieldError for fields of nested structs, joining the field
+// names with dots.
+func fieldError(name string, err error) error {
+	e, ok := err.(*DecodeError)
+	if ok && e.Field != "" {
+		if strings.HasPrefix(e.Field, "[") {
+			return &DecodeError{Field: name + e.Field, Err: e.Err}
+		}
+		return &DecodeError{Field: name + "." + e.Field, Err: e.Err}
+	}
+	
+	return FieldError(name, err)
+}
+
+func unmarshalValue(r BinaryReader, v reflect.Value, tag mcTag) (err error) {
+	if tag.optional {
+		if v.Kind() != reflect.Ptr {
+			return fmt.Errorf("Optional field of type %s is not a pointer", v.Type().String())
+		}
+		
+		present, err := r.ReadBool()
+		if err != nil {
+			return err
+		}
+		
+		if !present {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		
+		tag.optional = false
+	}
+	
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(r, v.Elem(), tag)
+	
+	case reflect.Bool:
+		x, err := r.ReadBool()
+		v.SetBool(x)
+		return err
+	
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		var x int64
+		
+		if tag.varint && v.Kind() == reflect.Int64 {
+			x, err = r.ReadVarint64()
+			
+		} else if tag.varint {
+			n, e := r.ReadVarint32()
+			x, err = int64(n), e
+			
+		} else {
+			switch v.Kind() {
+			case reflect.Int8:
+				n, e := r.ReadInt8()
+				x, err = int64(n), e
+			case reflect.Int16:
+				n, e := r.ReadInt16()
+				x, err = int64(n), e
+			case reflect.Int32:
+				n, e := r.ReadInt32()
+				x, err = int64(n), e
+			case reflect.Int64:
+				x, err = r.ReadInt64()
+			default:
+				return fmt.Errorf("Cannot unmarshal value of type %s without a varint tag", v.Type().String())
+			}
+		}
+		if err != nil {
+			return err
+		}
+		
+		if v.OverflowInt(x) {
+			return fmt.Errorf("Value %d overflows %s", x, v.Type().String())
+		}
+		v.SetInt(x)
+		return nil
+	
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		var x uint64
+		
+		if tag.varint {
+			x, err = r.ReadVarint()
+		
+		} else {
+			switch v.Kind() {
+			case reflect.Uint8:
+				n, e := r.ReadUint8()
+				x, err = uint64(n), e
+			case reflect.Uint16:
+				n, e := r.ReadUint16()
+				x, err = uint64(n), e
+			case reflect.Uint32:
+				n, e := r.ReadUint32()
+				x, err = uint64(n), e
+			case reflect.Uint64:
+				x, err = r.ReadUint64()
+			default:
+				return fmt.Errorf("Cannot unmarshal value of type %s without a varint tag", v.Type().String())
+			}
+		}
+		if err != nil {
+			return err
+		}
+		
+		if v.OverflowUint(x) {
+			return fmt.Errorf("Value %d overflows %s", x, v.Type().String())
+		}
+		v.SetUint(x)
+		return nil
+	
+	case reflect.Float32:
+		x, err := r.ReadFloat32()
+		v.SetFloat(float64(x))
+		return err
+	
+	case reflect.Float64:
+		x, err := r.ReadFloat64()
+		v.SetFloat(x)
+		return err
+	
+	case reflect.String:
+		max := tag.max
+		if max == 0 {
+			max = MaxStringLength
+		}
+		
+		if tag.prefix == "" || tag.prefix == "varint" {
+			s, err := r.ReadStringMax(max)
+			v.SetString(s)
+			return err
+		}
+		
+		n, err := readLength(r, tag.prefix, max*4)
+		if err != nil {
+			return err
+		}
+		
+		buf, err := r.ReadBytes(n)
+		if err != nil {
+			return err
+		}
+		
+		if utf8.RuneCount(buf) > max {
+			return fmt.Errorf("String length %d exceeds maximum of %d", utf8.RuneCount(buf), max)
+		}
+		
+		v.SetString(string(buf))
+		return nil
+	
+	case reflect.Slice:
+		if tag.rest {
+			if v.Type().Elem().Kind() != reflect.Uint8 {
+				return fmt.Errorf("Rest field of type %s is not a byte slice", v.Type().String())
+			}
+			
+			buf, err := r.ReadRemaining()
+			if err != nil {
+				return err
+			}
+			
+			v.SetBytes(buf)
+			return nil
+		}
+		
+		max := tag.max
+		if max == 0 {
+			max = MaxPacketLength
+		}
+		
+		n, err := readLength(r, tag.prefix, max)
+		if err != nil {
+			return err
+		}
+		
+		if v.Type().Elem().Kind() == reflect.Uint8 && !tag.varint {
+			buf, err := r.ReadBytes(n)
+			if err != nil {
+				return err
+			}
+			
+			s := reflect.MakeSlice(v.Type(), n, n)
+			reflect.Copy(s, reflect.ValueOf(buf))
+			v.Set(s)
+			return nil
+		}
+		
+		// Grow the slice as elements are read rather than trusting the
+		// length prefix.
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for i := 0; i < n; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			
+			err = unmarshalValue(r, elem, tag.elemTag())
+			if err != nil {
+				return fieldError(fmt.Sprintf("[%d]", i), err)
+			}
+			
+			v.Set(reflect.Append(v, elem))
+		}
+		
+		return nil
+	
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err = unmarshalValue(r, v.Index(i), tag.elemTag())
+			if err != nil {
+				return fieldError(fmt.Sprintf("[%d]", i), err)
+			}
+		}
+		
+		return nil
+	
+	case reflect.Struct:
+		return unmarshalStruct(r, v)
+	}
+	
+	return fmt.Errorf("Cannot unmarshal value of type %s", v.Type().String())
+}
+
+func writeLength(w BinaryWriter, prefix string, n int) (err error) {
+	switch prefix {
+	case "uint8":
+		if n > math.MaxUint8 {
+			return fmt.Errorf("Length %d does not fit in a %s", n, prefix)
+		}
+		return w.WriteUint8(uint8(n))
+	
+	case "uint16":
+		if n > math.MaxUint16 {
+			return fmt.Errorf("Length %d does not fit in a %s", n, prefix)
+		}
+		return w.WriteUint16(uint16(n))
+	
+	case "int16":
+		if n > math.MaxInt16 {
+			return fmt.Errorf("Length %d does not fit in a %s", n, prefix)
+		}
+		return w.WriteInt16(int16(n))
+	
+	case "uint32":
+		return w.WriteUint32(uint32(n))
+	
+	case "int32":
+		if n > math.MaxInt32 {
+			return fmt.Errorf("Length %d does not fit in a %s", n, prefix)
+		}
+		return w.WriteInt32(int32(n))
+	}
+	
+	return w.WriteVarint(uint64(n))
+}
+
+// readLength reads a length prefix, checking that it is no more than max.
+func readLength(r BinaryReader, prefix string, max int) (n int, err error) {
+	var x int64
+	
+	switch prefix {
+	case "uint8":
+		v, e := r.ReadUint8()
+		x, err = int64(v), e
+	case "uint16":
+		v, e := r.ReadUint16()
+		x, err = int64(v), e
+	case "int16":
+		v, e := r.ReadInt16()
+		x, err = int64(v), e
+	case "uint32":
+		v, e := r.ReadUint32()
+		x, err = int64(v), e
+	case "int32":
+		v, e := r.ReadInt32()
+		x, err = int64(v), e
+	default:
+		v, e := r.ReadVarint()
+		if v > math.MaxInt32 {
+			v = math.MaxInt32
+		}
+		x, err = int64(v), e
+	}
+	if err != nil {
+		return 0, err
+	}
+	
+	if x < 0 {
+		return 0, fmt.Errorf("Negative length %d", x)
+	}
+	
+	if x > int64(max) {
+		return 0, fmt.Errorf("Length %d exceeds maximum of %d", x, max)
+	}
+	
+	return int(x), nil
+}
+
+// structPacket adapts a type with an ID method but no Read or Write methods to
+// the Packet interface, using Marshal and Unmarshal.
+type structPacket struct {
+	v interface{
+		ID() PacketID
+	}
+}
+
+func (packet *structPacket) ID() (id PacketID) {
+	return packet.v.ID()
+}
+
+func (packet *structPacket) Read(r BinaryReader) (err error) {
+	return Unmarshal(r, packet.v)
+}
+
+func (packet *structPacket) Write(w BinaryWriter) (err error) {
+	return Marshal(w, packet.v)
+}
+
+type versionedStructPacket struct {
+	structPacket
+}
+
+func (packet *versionedStructPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return packet.v.(interface{
+		VersionID(uint64) (PacketID, bool)
+	}).VersionID(version)
+}
+
+// AsPacket returns a Packet that encodes v (a pointer to a struct) with
+// Marshal and Unmarshal, for sending packet types that only define an ID
+// method (and optionally VersionID). Types that already implement Packet are
+// returned unchanged.
+func AsPacket(v interface{
+	ID() PacketID
+}) (packet Packet) {
+	if packet, ok := v.(Packet); ok {
+		return packet
+	}
+	
+	if _, ok := v.(interface{
+		VersionID(uint64) (PacketID, bool)
+	}); ok {
+		return &versionedStructPacket{structPacket{v}}
+	}
+	
+	return &structPacket{v}
+}
+
+// newPacket returns a new packet of the given (struct) type.
+func newPacket(t reflect.Type) (packet Packet) {
+	return AsPacket(reflect.New(t).Interface().(interface{
+		ID() PacketID
+	}))
+}
+
+// packetValue returns the value wrapped by AsPacket, or the packet itself.
+func packetValue(packet Packet) (v interface{}) {
+	switch p := packet.(type) {
+	case *structPacket:
+		return p.v
+	case *versionedStructPacket:
+		return p.v
+	}
+	return packet
+}
+
+// packetType returns the struct type of a packet.
+func packetType(packet Packet) (t reflect.Type) {
+	return reflect.TypeOf(packetValue(packet)).Elem()
+}
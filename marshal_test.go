@@ -0,0 +1,443 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testNumbers struct {
+	B bool
+	I8 int8
+	I16 int16
+	I32 int32
+	I64 int64
+	U8 uint8
+	U16 uint16
+	U32 uint32
+	U64 uint64
+	F32 float32
+	F64 float64
+}
+
+type testVarints struct {
+	A int32 `mc:"varint"`
+	B int64 `mc:"varint"`
+	C uint16 `mc:"varint"`
+	D int `mc:"varint"`
+}
+
+type testStrings struct {
+	S string
+	Max string `mc:"string,max=3"`
+	Short string `mc:"prefixed=uint16"`
+}
+
+type testSlices struct {
+	Bytes []byte
+	Shorts []int16 `mc:"prefixed=uint8"`
+	Varints []int32 `mc:"varint"`
+	Fixed [2]uint8
+	Names []string
+}
+
+type testOptional struct {
+	Present *int32 `mc:"optional"`
+	Absent *string `mc:"optional"`
+	Ptr *uint8
+}
+
+type testRest struct {
+	ID int32 `mc:"varint"`
+	Data []byte `mc:"rest"`
+}
+
+type testSkip struct {
+	A uint8
+	Skipped string `mc:"-"`
+	unexported int64
+	B uint8
+}
+
+type testEntry struct {
+	ID int32 `mc:"varint"`
+	Name string
+}
+
+type testNested struct {
+	Pos struct {
+		X, Y int16
+	}
+	Entries []testEntry
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	present := int32(5)
+	nine := uint8(9)
+	
+	nested := &testNested{Entries: []testEntry{{1, "a"}, {300, ""}}}
+	nested.Pos.X, nested.Pos.Y = 1, -2
+	
+	tests := []struct {
+		name string
+		data string
+		value interface{}
+	}{
+		{"numbers", "01" + "ff" + "8000" + "00000001" + "fffffffffffffffe" + "ff" + "ffff" + "00000002" + "0000000000000003" + "3fc00000" + "4004000000000000", &testNumbers{
+			B: true,
+			I8: -1,
+			I16: -32768,
+			I32: 1,
+			I64: -2,
+			U8: 255,
+			U16: 65535,
+			U32: 2,
+			U64: 3,
+			F32: 1.5,
+			F64: 2.5,
+		}},
+		{"varints", "ffffffff0f" + "ffffffffffffffffff01" + "ac02" + "05", &testVarints{-1, -1, 300, 5}},
+		{"strings", "026869" + "09e282ace282ace282ac" + "000368c3a9", &testStrings{"hi", "€€€", "hé"}},
+		{"empty strings", "00" + "00" + "0000", &testStrings{}},
+		{"slices", "020102" + "020001ffff" + "01ac02" + "0708" + "010161", &testSlices{
+			Bytes: []byte{1, 2},
+			Shorts: []int16{1, -1},
+			Varints: []int32{300},
+			Fixed: [2]uint8{7, 8},
+			Names: []string{"a"},
+		}},
+		{"empty slices", "00" + "00" + "00" + "0000" + "00", &testSlices{
+			Bytes: []byte{},
+			Shorts: []int16{},
+			Varints: []int32{},
+			Names: []string{},
+		}},
+		{"optional", "01" + "00000005" + "00" + "09", &testOptional{Present: &present, Ptr: &nine}},
+		{"rest", "01" + "010203", &testRest{1, []byte{1, 2, 3}}},
+		{"skipped fields", "0102", &testSkip{A: 1, B: 2}},
+		{"nested", "0001" + "fffe" + "02" + "01" + "0161" + "ac02" + "00", nested},
+	}
+	
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		
+		err := Marshal(NewBinaryWriter(buf), test.value)
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if hex.EncodeToString(buf.Bytes()) != test.data {
+			t.Errorf("%s: wrote %x, expected %s", test.name, buf.Bytes(), test.data)
+			continue
+		}
+		
+		value := reflect.New(reflect.TypeOf(test.value).Elem()).Interface()
+		
+		err = Unmarshal(NewBinaryReader(buf), value)
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, buf.Len())
+		}
+		
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: read %+v, expected %+v", test.name, value, test.value)
+		}
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag string
+		expected mcTag
+	}{
+		{"", mcTag{}},
+		{"-", mcTag{skip: true}},
+		{"string", mcTag{}},
+		{"varint", mcTag{varint: true}},
+		{"optional", mcTag{optional: true}},
+		{"rest", mcTag{rest: true}},
+		{"string,max=256", mcTag{max: 256}},
+		{"prefixed=uint16,max=10", mcTag{prefix: "uint16", max: 10}},
+		{"varint,prefixed=int32", mcTag{varint: true, prefix: "int32"}},
+		{"optional,prefixed=varint", mcTag{optional: true, prefix: "varint"}},
+	}
+	
+	for _, test := range tests {
+		tag, err := parseTag(test.tag)
+		if err != nil {
+			t.Errorf("%q: parse failed: %s", test.tag, err.Error())
+			continue
+		}
+		
+		if tag != test.expected {
+			t.Errorf("%q: parsed %+v, expected %+v", test.tag, tag, test.expected)
+		}
+	}
+}
+
+func TestParseTagErrors(t *testing.T) {
+	tests := []string{
+		"bogus",
+		"varint,bogus",
+		"prefixed",
+		"prefixed=int8",
+		"prefixed=uint64",
+		"max",
+		"max=x",
+		"max=-1",
+		"-,varint",
+	}
+	
+	for _, tag := range tests {
+		_, err := parseTag(tag)
+		if err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		value interface{}
+	}{
+		{"not a pointer", testNumbers{}},
+		{"pointer to a non-struct", new(int32)},
+		{"nil pointer", (*testNumbers)(nil)},
+		{"unknown tag option", &struct {
+			A int32 `mc:"bogus"`
+		}{}},
+		{"map", &struct {
+			M map[string]int32
+		}{}},
+		{"interface", &struct {
+			I interface{}
+		}{}},
+		{"complex", &struct {
+			C complex64
+		}{}},
+		{"int without varint tag", &struct {
+			N int
+		}{}},
+		{"uint without varint tag", &struct {
+			N uint
+		}{}},
+		{"optional non-pointer", &struct {
+			N int32 `mc:"optional"`
+		}{}},
+		{"nil pointer field", &struct {
+			P *int32
+		}{}},
+		{"nil pointer in slice", &struct {
+			P []*int32
+		}{[]*int32{nil}}},
+		{"string longer than max", &struct {
+			S string `mc:"max=3"`
+		}{"abcd"}},
+		{"slice longer than max", &struct {
+			S []int32 `mc:"max=2"`
+		}{[]int32{1, 2, 3}}},
+		{"length too long for uint8", &struct {
+			S []byte `mc:"prefixed=uint8"`
+		}{make([]byte, 256)}},
+		{"length too long for uint16", &struct {
+			S string `mc:"prefixed=uint16"`
+		}{strings.Repeat("a", 65536)}},
+		{"length too long for int16", &struct {
+			S []byte `mc:"prefixed=int16"`
+		}{make([]byte, 32768)}},
+		{"nested struct with bad tag", &struct {
+			Inner struct {
+				A int32 `mc:"prefixed=int8"`
+			}
+		}{}},
+	}
+	
+	for _, test := range tests {
+		err := Marshal(NewBinaryWriter(bytes.NewBuffer(nil)), test.value)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		value interface{}
+	}{
+		{"not a pointer", "", testNumbers{}},
+		{"pointer to a non-struct", "", new(int32)},
+		{"unknown tag option", "00", &struct {
+			A int32 `mc:"bogus"`
+		}{}},
+		{"map", "00", &struct {
+			M map[string]int32
+		}{}},
+		{"int without varint tag", "00", &struct {
+			N int
+		}{}},
+		{"optional non-pointer", "01", &struct {
+			N int32 `mc:"optional"`
+		}{}},
+		{"rest of non-bytes", "0102", &struct {
+			R []int32 `mc:"rest"`
+		}{}},
+		{"truncated int", "0001", &struct {
+			N int32
+		}{}},
+		{"truncated optional", "01", &testOptional{}},
+		{"varint overflows int8", "c801", &struct {
+			N int8 `mc:"varint"`
+		}{}},
+		{"varint overflows uint8", "ac02", &struct {
+			N uint8 `mc:"varint"`
+		}{}},
+		{"string longer than max", "0461616161", &struct {
+			S string `mc:"max=3"`
+		}{}},
+		{"string length longer than max", "0d61", &struct {
+			S string `mc:"max=3"`
+		}{}},
+		{"string longer than default max", "ffff07", &struct {
+			S string
+		}{}},
+		{"prefixed string longer than max", "0003616263", &struct {
+			S string `mc:"prefixed=uint16,max=2"`
+		}{}},
+		{"prefixed string length longer than max", "0009", &struct {
+			S string `mc:"prefixed=uint16,max=2"`
+		}{}},
+		{"negative int16 length", "ffff", &struct {
+			S []byte `mc:"prefixed=int16"`
+		}{}},
+		{"negative int32 length", "ffffffff", &struct {
+			S string `mc:"prefixed=int32"`
+		}{}},
+		{"slice longer than max", "03000000010000000200000003", &struct {
+			S []int32 `mc:"max=2"`
+		}{}},
+		{"slice length past MaxPacketLength", "ffffffff0f", &struct {
+			S []int32
+		}{}},
+		{"slice longer than input", "7f", &struct {
+			S []int32
+		}{}},
+		{"byte slice longer than input", "050102", &struct {
+			S []byte
+		}{}},
+		{"truncated array", "0102", &struct {
+			A [3]uint8
+		}{}},
+	}
+	
+	for _, test := range tests {
+		err := Unmarshal(NewBinaryReader(bytes.NewReader(mustDecodeHex(test.data))), test.value)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestUnmarshalErrorField(t *testing.T) {
+	data := "0001" + "fffe" + "02" + "01" + "0161" + "02" + "0561"
+	
+	err := Unmarshal(NewBinaryReader(bytes.NewReader(mustDecodeHex(data))), &testNested{})
+	e, ok := err.(*DecodeError)
+	if !ok || e.Field != "Entries[1].Name" {
+		t.Errorf("Got error %v, expected one in Entries[1].Name", err)
+	}
+}
+
+type testStructPacket struct {
+	X int32 `mc:"varint"`
+}
+
+func (packet *testStructPacket) ID() (id PacketID) {
+	return PacketID{Play, Clientbound, 0x10}
+}
+
+type testVersionedStructPacket struct {
+	testStructPacket
+}
+
+func (packet *testVersionedStructPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	if version < 47 {
+		return PacketID{}, false
+	}
+	return PacketID{Play, Clientbound, version}, true
+}
+
+func TestAsPacket(t *testing.T) {
+	v := &testStructPacket{300}
+	packet := AsPacket(v)
+	
+	if packet.ID() != v.ID() {
+		t.Errorf("Packet has ID %s, expected %s", packet.ID().String(), v.ID().String())
+	}
+	
+	if _, ok := packet.(VersionedPacket); ok {
+		t.Errorf("Packet without VersionID is a VersionedPacket")
+	}
+	
+	if packetValue(packet) != v || packetType(packet) != reflect.TypeOf(*v) {
+		t.Errorf("Packet does not wrap the value passed to AsPacket")
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	err := packet.Write(NewBinaryWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !bytes.Equal(buf.Bytes(), mustDecodeHex("ac02")) {
+		t.Errorf("Wrote %x, expected ac02", buf.Bytes())
+	}
+	
+	read := newPacket(reflect.TypeOf(*v))
+	err = read.Read(NewBinaryReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !reflect.DeepEqual(packetValue(read), v) {
+		t.Errorf("Read %+v, expected %+v", packetValue(read), v)
+	}
+}
+
+func TestAsPacketVersioned(t *testing.T) {
+	packet, ok := AsPacket(&testVersionedStructPacket{}).(VersionedPacket)
+	if !ok {
+		t.Fatalf("Packet with VersionID is not a VersionedPacket")
+	}
+	
+	id, ok := packet.VersionID(340)
+	if !ok || id != (PacketID{Play, Clientbound, 340}) {
+		t.Errorf("VersionID(340) returned %s, %t", id.String(), ok)
+	}
+	
+	_, ok = packet.VersionID(5)
+	if ok {
+		t.Errorf("VersionID(5) returned true")
+	}
+}
+
+func TestAsPacketUnchanged(t *testing.T) {
+	p := &LC3SetCompressionPacket{Threshold: 256}
+	
+	if AsPacket(p) != Packet(p) {
+		t.Errorf("AsPacket wrapped a type that is already a Packet")
+	}
+	
+	if packetValue(p) != p {
+		t.Errorf("packetValue of a Packet is not the packet itself")
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+)
+
+import crand "crypto/rand"
+
+// MemoryAuthService is an AuthService that keeps its accounts and sessions in
+// memory, standing in for the real authentication and session servers.
+type MemoryAuthService struct {
+	lock sync.Mutex
+	accounts map[string]*memoryAccount
+	joins map[string]string
+}
+
+type memoryAccount struct {
+	password string
+	profile Profile
+	accessToken string
+	clientToken string
+}
+
+func NewMemoryAuthService() (service *MemoryAuthService) {
+	return &MemoryAuthService{
+		accounts: make(map[string]*memoryAccount),
+		joins: make(map[string]string),
+	}
+}
+
+// AddAccount registers an account that can log in with username and password
+// and plays as the given profile.
+func (service *MemoryAuthService) AddAccount(username, password string, profile Profile) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	service.accounts[username] = &memoryAccount{
+		password: password,
+		profile: profile,
+	}
+}
+
+func (service *MemoryAuthService) Authenticate(username, password, clientToken string) (session *AuthSession, err error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	account, ok := service.accounts[username]
+	if !ok || account.password != password {
+		return nil, fmt.Errorf("Invalid credentials")
+	}
+	
+	account.accessToken, err = randomToken()
+	if err != nil {
+		return nil, err
+	}
+	
+	if clientToken == "" {
+		clientToken, err = randomToken()
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	account.clientToken = clientToken
+	
+	session = &AuthSession{
+		AccessToken: account.accessToken,
+		ClientToken: clientToken,
+		Profile: account.profile,
+	}
+	
+	return session, nil
+}
+
+func (service *MemoryAuthService) Validate(accessToken, clientToken string) (err error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	if service.findSession(accessToken, clientToken) == nil {
+		return fmt.Errorf("Invalid token")
+	}
+	
+	return nil
+}
+
+func (service *MemoryAuthService) Refresh(accessToken, clientToken string) (session *AuthSession, err error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	account := service.findSession(accessToken, clientToken)
+	if account == nil {
+		return nil, fmt.Errorf("Invalid token")
+	}
+	
+	account.accessToken, err = randomToken()
+	if err != nil {
+		return nil, err
+	}
+	
+	session = &AuthSession{
+		AccessToken: account.accessToken,
+		ClientToken: account.clientToken,
+		Profile: account.profile,
+	}
+	
+	return session, nil
+}
+
+func (service *MemoryAuthService) Join(accessToken, profileID, serverHash string) (err error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	for _, account := range service.accounts {
+		if account.accessToken != "" && account.accessToken == accessToken && account.profile.ID == profileID {
+			service.joins[account.profile.Name] = serverHash
+			return nil
+		}
+	}
+	
+	return fmt.Errorf("Invalid session")
+}
+
+func (service *MemoryAuthService) HasJoined(username, serverHash string) (profile *Profile, err error) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	
+	joinedHash, ok := service.joins[username]
+	if !ok || joinedHash != serverHash {
+		return nil, fmt.Errorf("Authentication failure")
+	}
+	
+	for _, account := range service.accounts {
+		if account.profile.Name == username {
+			profile := account.profile
+			return &profile, nil
+		}
+	}
+	
+	return nil, fmt.Errorf("Authentication failure")
+}
+
+func (service *MemoryAuthService) findSession(accessToken, clientToken string) (account *memoryAccount) {
+	for _, account := range service.accounts {
+		if account.accessToken != "" && account.accessToken == accessToken && account.clientToken == clientToken {
+			return account
+		}
+	}
+	
+	return nil
+}
+
+func randomToken() (token string, err error) {
+	buf := make([]byte, 16)
+	_, err = io.ReadFull(crand.Reader, buf)
+	if err != nil {
+		return "", err
+	}
+	
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kierdavis/proxy/chat"
+	"time"
+)
+
+// Chat message positions.
+const (
+	chatPositionChat = 0
+	chatPositionSystem = 1
+	chatPositionActionBar = 2
+)
+
+// Protocol versions in which the packets used to send messages and titles
+// changed. Their numbers come from playNumbers, like those of the Disconnect
+// packet sent by Kick, so all of these work in the same protocol versions.
+const (
+	// 1.11: the action bar shows formatted text rather than only legacy
+	// formatting codes.
+	formattedActionBarVersion = 315
+	
+	// 1.17: the Title packet is split into a packet for each action.
+	splitTitleVersion = 755
+	
+	// 1.19: messages from the server are sent in System Chat Message.
+	systemChatVersion = 759
+)
+
+// Kick disconnects the player with the given reason. The session sends the
+// disconnect packet for its state and protocol version and then closes both
+// connections; Kick does not wait for it to finish. No reason is shown to
+// players who are only pinging the server. If the player is playing in a
+// protocol version whose Disconnect packet the proxy doesn't know, they are
+// disconnected without a reason and Kick returns an error.
+func (s *Session) Kick(reason *chat.Component) (err error) {
+	state, passing := s.passingState()
+	if passing && state == Play {
+		_, ok := playID("Disconnect", Clientbound, s.ProtocolVersion)
+		if !ok {
+			err = fmt.Errorf("Disconnect packet is not supported in protocol version %d", s.ProtocolVersion)
+		}
+	}
+	
+	s.close(reason)
+	return err
+}
+
+// SendMessage shows a system message in the player's chat.
+func (s *Session) SendMessage(message *chat.Component) (err error) {
+	version, err := s.playVersion()
+	if err != nil {
+		return err
+	}
+	
+	return s.sendChat(version, message, chatPositionSystem)
+}
+
+// SendActionBar shows a message above the player's hotbar. It is not supported
+// in 1.7.
+func (s *Session) SendActionBar(message *chat.Component) (err error) {
+	version, err := s.playVersion()
+	if err != nil {
+		return err
+	}
+	
+	if version < formattedActionBarVersion {
+		message = chat.Text(message.Legacy())
+	}
+	
+	return s.sendChat(version, message, chatPositionActionBar)
+}
+
+// SendTitle shows a title, and a subtitle if it is not nil, in the middle of
+// the player's screen. The times are rounded to ticks. Titles are not
+// supported in 1.7.
+func (s *Session) SendTitle(title, subtitle *chat.Component, fadeIn, stay, fadeOut time.Duration) (err error) {
+	version, err := s.playVersion()
+	if err != nil {
+		return err
+	}
+	
+	times := func(w BinaryWriter) (err error) {
+		for _, d := range []time.Duration{fadeIn, stay, fadeOut} {
+			err = w.WriteInt32(int32(d / (50 * time.Millisecond)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	text := func(c *chat.Component) func(w BinaryWriter) error {
+		return func(w BinaryWriter) error {
+			return w.WriteString(c.JSON())
+		}
+	}
+	
+	if version >= splitTitleVersion {
+		err = s.sendPlay(version, "SetTitleTimes", times)
+		if err == nil && subtitle != nil {
+			err = s.sendPlay(version, "SetSubtitleText", text(subtitle))
+		}
+		if err == nil {
+			err = s.sendPlay(version, "SetTitleText", text(title))
+		}
+		return err
+	}
+	
+	// Action bar text was added as action 2 in 1.11, moving the actions after
+	// it along.
+	timesAction := uint64(2)
+	if version >= formattedActionBarVersion {
+		timesAction = 3
+	}
+	
+	action := func(action uint64, write func(w BinaryWriter) error) func(w BinaryWriter) error {
+		return func(w BinaryWriter) (err error) {
+			err = w.WriteVarint(action)
+			if err != nil {
+				return err
+			}
+			return write(w)
+		}
+	}
+	
+	err = s.sendPlay(version, "Title", action(timesAction, times))
+	if err == nil && subtitle != nil {
+		err = s.sendPlay(version, "Title", action(1, text(subtitle)))
+	}
+	if err == nil {
+		err = s.sendPlay(version, "Title", action(0, text(title)))
+	}
+	return err
+}
+
+func (s *Session) sendChat(version uint64, message *chat.Component, position uint8) (err error) {
+	if version >= systemChatVersion {
+		return s.sendPlay(version, "ClientboundChatMessage", func(w BinaryWriter) (err error) {
+			err = w.WriteString(message.JSON())
+			if err != nil {
+				return err
+			}
+			return w.WriteBool(position == chatPositionActionBar)
+		})
+	}
+	
+	if version < 47 && position == chatPositionActionBar {
+		return fmt.Errorf("The action bar is not supported in protocol version %d", version)
+	}
+	
+	return s.sendPlay(version, "ClientboundChatMessage", func(w BinaryWriter) (err error) {
+		err = w.WriteString(message.JSON())
+		if err != nil || version < 47 {
+			return err
+		}
+		
+		err = w.WriteUint8(position)
+		if err != nil || version < 754 {
+			return err
+		}
+		
+		// Sender, which is not needed for system messages.
+		return w.WriteUUID(UUID{})
+	})
+}
+
+// playVersion returns the protocol version of the session, or an error if it
+// is not passing packets in the Play state.
+func (s *Session) playVersion() (version uint64, err error) {
+	state, passing := s.passingState()
+	if !passing || state != Play {
+		return 0, fmt.Errorf("Cannot send messages outside the Play state")
+	}
+	
+	return s.ProtocolVersion, nil
+}
+
+// sendPlay sends a clientbound Play packet, named as in playNumbers, whose body
+// is written by write.
+func (s *Session) sendPlay(version uint64, name string, write func(w BinaryWriter) error) (err error) {
+	id, ok := playID(name, Clientbound, version)
+	if !ok {
+		return fmt.Errorf("%s packet is not supported in protocol version %d", name, version)
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	err = write(NewVersionedBinaryWriter(buf, version))
+	if err != nil {
+		return err
+	}
+	
+	return s.Send(&RawPacket{id, buf.Bytes()})
+}
@@ -0,0 +1,214 @@
+// Package nbt reads and writes Minecraft's Named Binary Tag format as sent over
+// the network.
+//
+// Tags are decoded into a generic tree of Go values:
+//
+//   TagByte      int8
+//   TagShort     int16
+//   TagInt       int32
+//   TagLong      int64
+//   TagFloat     float32
+//   TagDouble    float64
+//   TagByteArray []byte
+//   TagString    string
+//   TagList      List
+//   TagCompound  Compound
+//   TagIntArray  []int32
+//   TagLongArray []int64
+//
+// Decode and Encode convert between such a tree and Go structs.
+//
+// Before 1.20.2 the root tag of a network NBT value is named (usually with the
+// empty string); from 1.20.2 the name is left out. Read and Write handle the
+// former, ReadNameless and WriteNameless the latter.
+package nbt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+type Tag byte
+
+const (
+	TagEnd Tag = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+func (t Tag) String() string {
+	switch t {
+	case TagEnd:
+		return "TAG_End"
+	case TagByte:
+		return "TAG_Byte"
+	case TagShort:
+		return "TAG_Short"
+	case TagInt:
+		return "TAG_Int"
+	case TagLong:
+		return "TAG_Long"
+	case TagFloat:
+		return "TAG_Float"
+	case TagDouble:
+		return "TAG_Double"
+	case TagByteArray:
+		return "TAG_Byte_Array"
+	case TagString:
+		return "TAG_String"
+	case TagList:
+		return "TAG_List"
+	case TagCompound:
+		return "TAG_Compound"
+	case TagIntArray:
+		return "TAG_Int_Array"
+	case TagLongArray:
+		return "TAG_Long_Array"
+	}
+	
+	return fmt.Sprintf("TAG_Unknown(%d)", byte(t))
+}
+
+// Maximum nesting depth of lists and compounds.
+const MaxDepth = 512
+
+// Compound is the value of a TAG_Compound.
+type Compound map[string]interface{}
+
+// List is the value of a TAG_List. Every element has type Type; an empty list
+// usually has type TagEnd.
+type List struct {
+	Type Tag
+	Values []interface{}
+}
+
+// TypeOf returns the tag type of a value in a generic tree, or false if the
+// value is not one of the types listed in the package documentation.
+func TypeOf(value interface{}) (t Tag, ok bool) {
+	switch value.(type) {
+	case int8:
+		return TagByte, true
+	case int16:
+		return TagShort, true
+	case int32:
+		return TagInt, true
+	case int64:
+		return TagLong, true
+	case float32:
+		return TagFloat, true
+	case float64:
+		return TagDouble, true
+	case []byte:
+		return TagByteArray, true
+	case string:
+		return TagString, true
+	case List:
+		return TagList, true
+	case Compound:
+		return TagCompound, true
+	case []int32:
+		return TagIntArray, true
+	case []int64:
+		return TagLongArray, true
+	}
+	
+	return TagEnd, false
+}
+
+// PathError is an error found at a point in a tree, such as
+// "display.Lore[2]".
+type PathError struct {
+	Path string
+	Err error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+
+// atName and atIndex add a compound entry name or list index to the front of the
+// path of an error.
+func atName(name string, err error) error {
+	e, ok := err.(*PathError)
+	if !ok {
+		return &PathError{Path: name, Err: err}
+	}
+	
+	if strings.HasPrefix(e.Path, "[") {
+		e.Path = name + e.Path
+	} else {
+		e.Path = name + "." + e.Path
+	}
+	return e
+}
+
+func atIndex(i int, err error) error {
+	e, ok := err.(*PathError)
+	if !ok {
+		return &PathError{Path: fmt.Sprintf("[%d]", i), Err: err}
+	}
+	
+	if strings.HasPrefix(e.Path, "[") {
+		e.Path = fmt.Sprintf("[%d]%s", i, e.Path)
+	} else {
+		e.Path = fmt.Sprintf("[%d].%s", i, e.Path)
+	}
+	return e
+}
+
+// Strings are sent in Java's modified UTF-8: characters outside the Basic
+// Multilingual Plane are sent as two encoded surrogates, and NUL as two bytes.
+
+func decodeString(buf []byte) (s string, err error) {
+	units := make([]uint16, 0, len(buf))
+	
+	for i := 0; i < len(buf); {
+		b := buf[i]
+		switch {
+		case b < 0x80:
+			units = append(units, uint16(b))
+			i++
+		
+		case b & 0xe0 == 0xc0 && i + 1 < len(buf) && buf[i + 1] & 0xc0 == 0x80:
+			units = append(units, uint16(b & 0x1f) << 6 | uint16(buf[i + 1] & 0x3f))
+			i += 2
+		
+		case b & 0xf0 == 0xe0 && i + 2 < len(buf) && buf[i + 1] & 0xc0 == 0x80 && buf[i + 2] & 0xc0 == 0x80:
+			units = append(units, uint16(b & 0x0f) << 12 | uint16(buf[i + 1] & 0x3f) << 6 | uint16(buf[i + 2] & 0x3f))
+			i += 3
+		
+		default:
+			return "", fmt.Errorf("Invalid modified UTF-8 at byte %d of string", i)
+		}
+	}
+	
+	return string(utf16.Decode(units)), nil
+}
+
+func encodeString(s string) (buf []byte) {
+	buf = make([]byte, 0, len(s))
+	
+	for _, u := range utf16.Encode([]rune(s)) {
+		switch {
+		case u != 0 && u < 0x80:
+			buf = append(buf, byte(u))
+		case u < 0x800:
+			buf = append(buf, 0xc0 | byte(u >> 6), 0x80 | byte(u & 0x3f))
+		default:
+			buf = append(buf, 0xe0 | byte(u >> 12), 0x80 | byte(u >> 6 & 0x3f), 0x80 | byte(u & 0x3f))
+		}
+	}
+	
+	return buf
+}
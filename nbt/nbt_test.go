@@ -0,0 +1,243 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustDecodeHex(s string) (buf []byte) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+// roundTripTest describes a value that should be written as data, and read
+// back from it again, with a root named name or with a nameless root.
+type roundTripTest struct {
+	name string
+	rootName string
+	nameless bool
+	data string
+	value interface{}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []roundTripTest{
+		{"byte", "", false, "010000" + "7f", int8(127)},
+		{"short", "", false, "020000" + "8000", int16(-32768)},
+		{"int", "", false, "030000" + "00000001", int32(1)},
+		{"long", "", false, "040000" + "ffffffffffffffff", int64(-1)},
+		{"float", "", false, "050000" + "3fc00000", float32(1.5)},
+		{"double", "", false, "060000" + "4004000000000000", float64(2.5)},
+		{"byte array", "", false, "070000" + "00000003" + "010203", []byte{1, 2, 3}},
+		{"string", "", false, "080000" + "0005" + "68656c6c6f", "hello"},
+		{"modified UTF-8 string", "", false, "080000" + "0009" + "61" + "c080" + "eda0bdedb880", "a\x00\U0001F600"},
+		{"list", "", false, "090000" + "02" + "00000002" + "0001" + "0002", List{TagShort, []interface{}{int16(1), int16(2)}}},
+		{"empty list", "", false, "090000" + "00" + "00000000", List{Type: TagEnd}},
+		{"compound", "", false, "0a0000" + "01000161" + "01" + "08000162" + "000178" + "00", Compound{"a": int8(1), "b": "x"}},
+		{"nested compound", "", false, "0a0000" + "0900016c" + "0a" + "00000001" + "00" + "00", Compound{"l": List{TagCompound, []interface{}{Compound{}}}}},
+		{"int array", "", false, "0b0000" + "00000002" + "00000001" + "fffffffe", []int32{1, -2}},
+		{"long array", "", false, "0c0000" + "00000001" + "0000000000000005", []int64{5}},
+		{"named root", "hi", false, "0100026869" + "05", int8(5)},
+		{"missing value", "", false, "00", nil},
+		{"nameless int", "", true, "03" + "00000001", int32(1)},
+		{"nameless compound", "", true, "0a" + "00", Compound{}},
+		{"nameless missing value", "", true, "00", nil},
+	}
+	
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		
+		var err error
+		if test.nameless {
+			err = WriteNameless(buf, test.value)
+		} else {
+			err = Write(buf, test.rootName, test.value)
+		}
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if hex.EncodeToString(buf.Bytes()) != test.data {
+			t.Errorf("%s: wrote %x, expected %s", test.name, buf.Bytes(), test.data)
+			continue
+		}
+		
+		var name string
+		var value interface{}
+		if test.nameless {
+			value, err = ReadNameless(buf)
+		} else {
+			name, value, err = Read(buf)
+		}
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, buf.Len())
+		}
+		
+		if name != test.rootName {
+			t.Errorf("%s: read root name %q, expected %q", test.name, name, test.rootName)
+		}
+		
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: read %#v, expected %#v", test.name, value, test.value)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty input", ""},
+		{"unknown tag", "0d0000"},
+		{"truncated root name", "010005" + "6162"},
+		{"truncated int", "030000" + "0001"},
+		{"negative byte array length", "070000" + "ffffffff"},
+		{"byte array longer than input", "070000" + "7fffffff" + "01"},
+		{"negative int array length", "0b0000" + "80000000"},
+		{"truncated int array", "0b0000" + "00000002" + "00000001"},
+		{"truncated long array", "0c0000" + "00000001" + "00000001"},
+		{"truncated string", "080000" + "0002" + "61"},
+		{"invalid modified UTF-8", "080000" + "0001" + "ff"},
+		{"truncated UTF-8 sequence", "080000" + "0001" + "c0"},
+		{"list of end tags", "090000" + "00" + "00000005"},
+		{"list of unknown tags", "090000" + "0d" + "00000001"},
+		{"negative list length", "090000" + "01" + "ffffffff"},
+		{"truncated list", "090000" + "01" + "00000003" + "0102"},
+		{"compound without end", "0a0000" + "01000161" + "01"},
+		{"compound entry with unknown tag", "0a0000" + "0d000161"},
+		{"nested too deep", "090000" + strings.Repeat("0900000001", MaxDepth) + "0100000000"},
+	}
+	
+	for _, test := range tests {
+		_, _, err := Read(bytes.NewReader(mustDecodeHex(test.data)))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestReadErrorPath(t *testing.T) {
+	data := "0a0000" + "09000161" + "03" + "00000002" + "00000001" + "0000"
+	
+	_, _, err := Read(bytes.NewReader(mustDecodeHex(data)))
+	e, ok := err.(*PathError)
+	if !ok || e.Path != "a[1]" {
+		t.Errorf("Got error %v, expected one at a[1]", err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	// One list more than MaxDepth deep.
+	deep := List{TagByte, []interface{}{int8(0)}}
+	for i := 0; i < MaxDepth; i++ {
+		deep = List{TagList, []interface{}{deep}}
+	}
+	
+	tests := []struct {
+		name string
+		value interface{}
+	}{
+		{"unsupported type", 5},
+		{"unsigned integer", uint8(5)},
+		{"list with mixed types", List{TagInt, []interface{}{int32(1), int8(2)}}},
+		{"list element of unsupported type", List{TagInt, []interface{}{5}}},
+		{"compound entry of unsupported type", Compound{"x": uint16(1)}},
+		{"string too long", strings.Repeat("a", 65536)},
+		{"nested too deep", deep},
+	}
+	
+	for _, test := range tests {
+		err := Write(bytes.NewBuffer(nil), "", test.value)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+type testItem struct {
+	Display struct {
+		Name string
+		Lore []string `nbt:",omitempty"`
+	} `nbt:"display"`
+	Enchantments []struct {
+		ID int16 `nbt:"id"`
+		Level uint16 `nbt:"lvl"`
+	} `nbt:"ench"`
+	Unbreakable bool
+	Colors []int32 `nbt:",list"`
+	Ignored string `nbt:"-"`
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var item testItem
+	item.Display.Name = "Sword"
+	item.Enchantments = append(item.Enchantments, struct {
+		ID int16 `nbt:"id"`
+		Level uint16 `nbt:"lvl"`
+	}{16, 65535})
+	item.Unbreakable = true
+	item.Colors = []int32{1, 2}
+	
+	expected := Compound{
+		"display": Compound{"Name": "Sword"},
+		"ench": List{TagCompound, []interface{}{Compound{"id": int16(16), "lvl": int16(-1)}}},
+		"Unbreakable": int8(1),
+		"Colors": List{TagInt, []interface{}{int32(1), int32(2)}},
+	}
+	
+	tree, err := Encode(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !reflect.DeepEqual(tree, expected) {
+		t.Fatalf("Encoded %#v, expected %#v", tree, expected)
+	}
+	
+	var decoded testItem
+	err = Decode(tree, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	if !reflect.DeepEqual(decoded, item) {
+		t.Errorf("Decoded %#v, expected %#v", decoded, item)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		value interface{}
+		v interface{}
+	}{
+		{"int that doesn't fit", int32(300), new(int8)},
+		{"bool that isn't 0 or 1", int8(2), new(bool)},
+		{"string into int", "x", new(int32)},
+		{"int into string", int32(1), new(string)},
+		{"list into struct", List{Type: TagEnd}, new(testItem)},
+		{"wrong array length", []int32{1, 2}, new([3]int32)},
+		{"wrong field type", Compound{"display": int8(1)}, new(testItem)},
+		{"not a pointer", int8(1), int8(0)},
+	}
+	
+	for _, test := range tests {
+		err := Decode(test.value, test.v)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
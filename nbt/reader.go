@@ -0,0 +1,275 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Read reads a tag with a named root, as sent before 1.20.2. A root of TAG_End,
+// which stands in for a missing value, is returned as a nil value.
+func Read(r io.Reader) (name string, value interface{}, err error) {
+	d := &decoder{r: r}
+	
+	t, err := d.readTag()
+	if err != nil || t == TagEnd {
+		return "", nil, err
+	}
+	
+	name, err = d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+	
+	value, err = d.readPayload(t)
+	if err != nil {
+		return "", nil, err
+	}
+	
+	return name, value, nil
+}
+
+// ReadNameless reads a tag with a nameless root, as sent from 1.20.2. A root of
+// TAG_End is returned as a nil value.
+func ReadNameless(r io.Reader) (value interface{}, err error) {
+	d := &decoder{r: r}
+	
+	t, err := d.readTag()
+	if err != nil || t == TagEnd {
+		return nil, err
+	}
+	
+	return d.readPayload(t)
+}
+
+type decoder struct {
+	r io.Reader
+	depth int
+}
+
+func (d *decoder) readTag() (t Tag, err error) {
+	var b [1]byte
+	_, err = io.ReadFull(d.r, b[:])
+	if err != nil {
+		return TagEnd, err
+	}
+	
+	t = Tag(b[0])
+	if t > TagLongArray {
+		return TagEnd, fmt.Errorf("Unknown tag type %d", b[0])
+	}
+	
+	return t, nil
+}
+
+func (d *decoder) readLength() (n int, err error) {
+	var x int32
+	err = binary.Read(d.r, binary.BigEndian, &x)
+	if err != nil {
+		return 0, err
+	}
+	
+	if x < 0 {
+		return 0, fmt.Errorf("Invalid length %d", x)
+	}
+	
+	return int(x), nil
+}
+
+// readBytes grows its buffer as data arrives, so that a bogus length can't be
+// used to exhaust memory.
+func (d *decoder) readBytes(count int64) (buf []byte, err error) {
+	b := bytes.NewBuffer(nil)
+	_, err = io.CopyN(b, d.r, count)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	return b.Bytes(), nil
+}
+
+func (d *decoder) readString() (s string, err error) {
+	var length uint16
+	err = binary.Read(d.r, binary.BigEndian, &length)
+	if err != nil {
+		return "", err
+	}
+	
+	buf := make([]byte, length)
+	_, err = io.ReadFull(d.r, buf)
+	if err != nil {
+		return "", err
+	}
+	
+	return decodeString(buf)
+}
+
+func (d *decoder) readPayload(t Tag) (value interface{}, err error) {
+	switch t {
+	case TagByte:
+		var x int8
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagShort:
+		var x int16
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagInt:
+		var x int32
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagLong:
+		var x int64
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagFloat:
+		var x float32
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagDouble:
+		var x float64
+		err = binary.Read(d.r, binary.BigEndian, &x)
+		return x, err
+	
+	case TagByteArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(int64(n))
+	
+	case TagString:
+		return d.readString()
+	
+	case TagList:
+		return d.readList()
+	
+	case TagCompound:
+		return d.readCompound()
+	
+	case TagIntArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		
+		buf, err := d.readBytes(int64(n) * 4)
+		if err != nil {
+			return nil, err
+		}
+		
+		x := make([]int32, n)
+		for i := range x {
+			x[i] = int32(binary.BigEndian.Uint32(buf[i * 4:]))
+		}
+		return x, nil
+	
+	case TagLongArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		
+		buf, err := d.readBytes(int64(n) * 8)
+		if err != nil {
+			return nil, err
+		}
+		
+		x := make([]int64, n)
+		for i := range x {
+			x[i] = int64(binary.BigEndian.Uint64(buf[i * 8:]))
+		}
+		return x, nil
+	}
+	
+	return nil, fmt.Errorf("Unexpected %s", t.String())
+}
+
+func (d *decoder) enter() (err error) {
+	d.depth++
+	if d.depth > MaxDepth {
+		return fmt.Errorf("Tag is nested more than %d deep", MaxDepth)
+	}
+	return nil
+}
+
+func (d *decoder) readList() (list List, err error) {
+	err = d.enter()
+	if err != nil {
+		return list, err
+	}
+	defer func() { d.depth-- }()
+	
+	list.Type, err = d.readTag()
+	if err != nil {
+		return list, err
+	}
+	
+	n, err := d.readLength()
+	if err != nil {
+		return list, err
+	}
+	
+	if n == 0 {
+		return list, nil
+	}
+	
+	// Every other element type takes at least one byte, so the length of the
+	// list is bounded by the length of the input.
+	if list.Type == TagEnd {
+		return list, fmt.Errorf("List of %d %s elements", n, TagEnd.String())
+	}
+	
+	for i := 0; i < n; i++ {
+		value, err := d.readPayload(list.Type)
+		if err != nil {
+			return list, atIndex(i, err)
+		}
+		
+		list.Values = append(list.Values, value)
+	}
+	
+	return list, nil
+}
+
+func (d *decoder) readCompound() (c Compound, err error) {
+	err = d.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+	
+	c = make(Compound)
+	
+	for {
+		t, err := d.readTag()
+		if err != nil {
+			return nil, err
+		}
+		
+		if t == TagEnd {
+			return c, nil
+		}
+		
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		
+		value, err := d.readPayload(t)
+		if err != nil {
+			return nil, atName(name, err)
+		}
+		
+		c[name] = value
+	}
+}
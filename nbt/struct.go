@@ -0,0 +1,450 @@
+package nbt
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Decode stores a generic tree, as returned by Read, in the value pointed to by
+// v. Struct fields are matched with compound entries by the name in their nbt
+// tag, or by their own name if they have none; entries with no matching field
+// are ignored, and fields with no matching entry are left alone.
+//
+// For example, the display name and enchantments of an item before 1.13 could
+// be decoded into:
+//
+//   type item struct {
+//       Display struct {
+//           Name string
+//       } `nbt:"display"`
+//       Enchantments []struct {
+//           ID int16 `nbt:"id"`
+//           Level int16 `nbt:"lvl"`
+//       } `nbt:"ench"`
+//   }
+//
+// Integer and floating point fields accept any numeric tag that fits, and bool
+// fields a tag that is zero or one.
+func Decode(value interface{}, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Cannot decode into %T: not a non-nil pointer", v)
+	}
+	
+	if value == nil {
+		return nil
+	}
+	
+	return decodeValue(value, rv.Elem())
+}
+
+// Encode converts a Go value into a generic tree that can be passed to Write.
+// It is the inverse of Decode: structs and string-keyed maps become compounds,
+// []int32 and []int64 become int arrays and long arrays, []byte becomes a byte
+// array and other slices and arrays become lists. Bools are sent as a byte, and
+// unsigned integers as the signed tag of the same size.
+//
+// The nbt tag of a struct field may give its name, and the options omitempty,
+// which leaves out a zero field, and list, which sends an []int32 or []int64
+// as a list rather than an array. Fields tagged "-" are left out, as are nil
+// pointers and interfaces.
+func Encode(v interface{}) (value interface{}, err error) {
+	if v == nil {
+		return nil, nil
+	}
+	
+	return encodeValue(reflect.ValueOf(v), false)
+}
+
+type fieldInfo struct {
+	index int
+	name string
+	omitEmpty bool
+	list bool
+}
+
+func structFields(t reflect.Type) (fields []fieldInfo) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		
+		tag := f.Tag.Get("nbt")
+		if tag == "-" {
+			continue
+		}
+		
+		info := fieldInfo{index: i, name: f.Name}
+		opts := strings.Split(tag, ",")
+		if opts[0] != "" {
+			info.name = opts[0]
+		}
+		
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				info.omitEmpty = true
+			case "list":
+				info.list = true
+			}
+		}
+		
+		fields = append(fields, info)
+	}
+	
+	return fields
+}
+
+func decodeValue(value interface{}, rv reflect.Value) (err error) {
+	vt := reflect.TypeOf(value)
+	if vt.AssignableTo(rv.Type()) {
+		rv.Set(reflect.ValueOf(value))
+		return nil
+	}
+	
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(value, rv.Elem())
+	
+	case reflect.Bool:
+		n, ok := intValue(value)
+		if !ok || (n != 0 && n != 1) {
+			break
+		}
+		rv.SetBool(n == 1)
+		return nil
+	
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := intValue(value)
+		if !ok || rv.OverflowInt(n) {
+			break
+		}
+		rv.SetInt(n)
+		return nil
+	
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := uintValue(value)
+		if !ok || rv.OverflowUint(n) {
+			break
+		}
+		rv.SetUint(n)
+		return nil
+	
+	case reflect.Float32, reflect.Float64:
+		switch x := value.(type) {
+		case float32:
+			rv.SetFloat(float64(x))
+			return nil
+		case float64:
+			rv.SetFloat(x)
+			return nil
+		}
+		
+		n, ok := intValue(value)
+		if !ok {
+			break
+		}
+		rv.SetFloat(float64(n))
+		return nil
+	
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			break
+		}
+		rv.SetString(s)
+		return nil
+	
+	case reflect.Slice, reflect.Array:
+		elems, ok := listValues(value)
+		if !ok {
+			break
+		}
+		
+		if rv.Kind() == reflect.Array {
+			if len(elems) != rv.Len() {
+				return fmt.Errorf("Cannot decode %d elements into %s", len(elems), rv.Type().String())
+			}
+		} else {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(elems), len(elems)))
+		}
+		
+		for i, elem := range elems {
+			err = decodeValue(elem, rv.Index(i))
+			if err != nil {
+				return atIndex(i, err)
+			}
+		}
+		return nil
+	
+	case reflect.Map:
+		c, ok := value.(Compound)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		
+		for name, elem := range c {
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			err = decodeValue(elem, ev)
+			if err != nil {
+				return atName(name, err)
+			}
+			rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), ev)
+		}
+		return nil
+	
+	case reflect.Struct:
+		c, ok := value.(Compound)
+		if !ok {
+			break
+		}
+		
+		for _, f := range structFields(rv.Type()) {
+			elem, ok := c[f.name]
+			if !ok {
+				continue
+			}
+			
+			err = decodeValue(elem, rv.Field(f.index))
+			if err != nil {
+				return atName(f.name, err)
+			}
+		}
+		return nil
+	}
+	
+	t, _ := TypeOf(value)
+	return fmt.Errorf("Cannot decode %s into %s", t.String(), rv.Type().String())
+}
+
+func intValue(value interface{}) (n int64, ok bool) {
+	switch x := value.(type) {
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	}
+	
+	return 0, false
+}
+
+// uintValue reads a signed tag as an unsigned integer of the same size, the
+// inverse of how Encode sends unsigned integers.
+func uintValue(value interface{}) (n uint64, ok bool) {
+	switch x := value.(type) {
+	case int8:
+		return uint64(uint8(x)), true
+	case int16:
+		return uint64(uint16(x)), true
+	case int32:
+		return uint64(uint32(x)), true
+	case int64:
+		return uint64(x), true
+	}
+	
+	return 0, false
+}
+
+func listValues(value interface{}) (elems []interface{}, ok bool) {
+	switch x := value.(type) {
+	case List:
+		return x.Values, true
+	
+	case []byte:
+		for _, b := range x {
+			elems = append(elems, int8(b))
+		}
+		return elems, true
+	
+	case []int32:
+		for _, n := range x {
+			elems = append(elems, n)
+		}
+		return elems, true
+	
+	case []int64:
+		for _, n := range x {
+			elems = append(elems, n)
+		}
+		return elems, true
+	}
+	
+	return nil, false
+}
+
+func encodeValue(rv reflect.Value, list bool) (value interface{}, err error) {
+	switch rv.Interface().(type) {
+	case List, Compound:
+		return rv.Interface(), nil
+	}
+	
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return encodeValue(rv.Elem(), list)
+	
+	case reflect.Bool:
+		if rv.Bool() {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	
+	case reflect.Int8:
+		return int8(rv.Int()), nil
+	
+	case reflect.Int16:
+		return int16(rv.Int()), nil
+	
+	case reflect.Int32:
+		return int32(rv.Int()), nil
+	
+	case reflect.Int:
+		n := rv.Int()
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("Value %d does not fit in %s", n, TagInt.String())
+		}
+		return int32(n), nil
+	
+	case reflect.Int64:
+		return rv.Int(), nil
+	
+	case reflect.Uint8:
+		return int8(rv.Uint()), nil
+	
+	case reflect.Uint16:
+		return int16(rv.Uint()), nil
+	
+	case reflect.Uint32:
+		return int32(rv.Uint()), nil
+	
+	case reflect.Uint:
+		n := rv.Uint()
+		if n > math.MaxUint32 {
+			return nil, fmt.Errorf("Value %d does not fit in %s", n, TagInt.String())
+		}
+		return int32(n), nil
+	
+	case reflect.Uint64:
+		return int64(rv.Uint()), nil
+	
+	case reflect.Float32:
+		return float32(rv.Float()), nil
+	
+	case reflect.Float64:
+		return rv.Float(), nil
+	
+	case reflect.String:
+		return rv.String(), nil
+	
+	case reflect.Slice, reflect.Array:
+		return encodeList(rv, list)
+	
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		
+		c := make(Compound)
+		iter := rv.MapRange()
+		for iter.Next() {
+			name := iter.Key().String()
+			elem, err := encodeValue(iter.Value(), false)
+			if err != nil {
+				return nil, atName(name, err)
+			}
+			if elem != nil {
+				c[name] = elem
+			}
+		}
+		return c, nil
+	
+	case reflect.Struct:
+		c := make(Compound)
+		for _, f := range structFields(rv.Type()) {
+			fv := rv.Field(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			
+			elem, err := encodeValue(fv, f.list)
+			if err != nil {
+				return nil, atName(f.name, err)
+			}
+			if elem != nil {
+				c[f.name] = elem
+			}
+		}
+		return c, nil
+	}
+	
+	return nil, fmt.Errorf("Cannot encode value of type %s as NBT", rv.Type().String())
+}
+
+func encodeList(rv reflect.Value, list bool) (value interface{}, err error) {
+	n := rv.Len()
+	
+	if !list {
+		switch rv.Type().Elem().Kind() {
+		case reflect.Uint8, reflect.Int8:
+			buf := make([]byte, n)
+			for i := range buf {
+				x, _ := encodeValue(rv.Index(i), false)
+				buf[i] = byte(x.(int8))
+			}
+			return buf, nil
+		
+		case reflect.Int32:
+			x := make([]int32, n)
+			for i := range x {
+				x[i] = int32(rv.Index(i).Int())
+			}
+			return x, nil
+		
+		case reflect.Int64:
+			x := make([]int64, n)
+			for i := range x {
+				x[i] = rv.Index(i).Int()
+			}
+			return x, nil
+		}
+	}
+	
+	l := List{Type: TagEnd}
+	for i := 0; i < n; i++ {
+		elem, err := encodeValue(rv.Index(i), false)
+		if err != nil {
+			return nil, atIndex(i, err)
+		}
+		
+		t, ok := TypeOf(elem)
+		if !ok {
+			return nil, atIndex(i, fmt.Errorf("Cannot encode nil element"))
+		}
+		
+		if i == 0 {
+			l.Type = t
+		} else if t != l.Type {
+			return nil, atIndex(i, fmt.Errorf("Element is %s but list is of %s", t.String(), l.Type.String()))
+		}
+		
+		l.Values = append(l.Values, elem)
+	}
+	
+	return l, nil
+}
@@ -0,0 +1,181 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Write writes value with a named root, as sent before 1.20.2. A nil value is
+// written as TAG_End.
+func Write(w io.Writer, name string, value interface{}) (err error) {
+	if value == nil {
+		return writeTag(w, TagEnd)
+	}
+	
+	t, ok := TypeOf(value)
+	if !ok {
+		return fmt.Errorf("Cannot write value of type %T as NBT", value)
+	}
+	
+	err = writeTag(w, t)
+	if err != nil {
+		return err
+	}
+	
+	err = writeString(w, name)
+	if err != nil {
+		return err
+	}
+	
+	return writePayload(w, value, 0)
+}
+
+// WriteNameless writes value with a nameless root, as sent from 1.20.2. A nil
+// value is written as TAG_End.
+func WriteNameless(w io.Writer, value interface{}) (err error) {
+	if value == nil {
+		return writeTag(w, TagEnd)
+	}
+	
+	t, ok := TypeOf(value)
+	if !ok {
+		return fmt.Errorf("Cannot write value of type %T as NBT", value)
+	}
+	
+	err = writeTag(w, t)
+	if err != nil {
+		return err
+	}
+	
+	return writePayload(w, value, 0)
+}
+
+func writeTag(w io.Writer, t Tag) (err error) {
+	_, err = w.Write([]byte{byte(t)})
+	return err
+}
+
+func writeLength(w io.Writer, n int) (err error) {
+	if n > math.MaxInt32 {
+		return fmt.Errorf("Length %d is too long", n)
+	}
+	return binary.Write(w, binary.BigEndian, int32(n))
+}
+
+func writeString(w io.Writer, s string) (err error) {
+	buf := encodeString(s)
+	if len(buf) > math.MaxUint16 {
+		return fmt.Errorf("String of %d bytes is too long", len(buf))
+	}
+	
+	err = binary.Write(w, binary.BigEndian, uint16(len(buf)))
+	if err != nil {
+		return err
+	}
+	
+	_, err = w.Write(buf)
+	return err
+}
+
+func writePayload(w io.Writer, value interface{}, depth int) (err error) {
+	switch x := value.(type) {
+	case int8, int16, int32, int64, float32, float64:
+		return binary.Write(w, binary.BigEndian, x)
+	
+	case []byte:
+		err = writeLength(w, len(x))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(x)
+		return err
+	
+	case string:
+		return writeString(w, x)
+	
+	case List:
+		if depth >= MaxDepth {
+			return fmt.Errorf("Tag is nested more than %d deep", MaxDepth)
+		}
+		
+		err = writeTag(w, x.Type)
+		if err != nil {
+			return err
+		}
+		
+		err = writeLength(w, len(x.Values))
+		if err != nil {
+			return err
+		}
+		
+		for i, elem := range x.Values {
+			t, ok := TypeOf(elem)
+			if !ok || t != x.Type {
+				return atIndex(i, fmt.Errorf("Value of type %T in list of %s", elem, x.Type.String()))
+			}
+			
+			err = writePayload(w, elem, depth + 1)
+			if err != nil {
+				return atIndex(i, err)
+			}
+		}
+		
+		return nil
+	
+	case Compound:
+		if depth >= MaxDepth {
+			return fmt.Errorf("Tag is nested more than %d deep", MaxDepth)
+		}
+		
+		// Names are written in order so that the output is deterministic.
+		names := make([]string, 0, len(x))
+		for name := range x {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		
+		for _, name := range names {
+			elem := x[name]
+			t, ok := TypeOf(elem)
+			if !ok {
+				return atName(name, fmt.Errorf("Cannot write value of type %T as NBT", elem))
+			}
+			
+			err = writeTag(w, t)
+			if err != nil {
+				return err
+			}
+			
+			err = writeString(w, name)
+			if err != nil {
+				return err
+			}
+			
+			err = writePayload(w, elem, depth + 1)
+			if err != nil {
+				return atName(name, err)
+			}
+		}
+		
+		return writeTag(w, TagEnd)
+	
+	case []int32:
+		err = writeLength(w, len(x))
+		if err != nil {
+			return err
+		}
+		return binary.Write(w, binary.BigEndian, x)
+	
+	case []int64:
+		err = writeLength(w, len(x))
+		if err != nil {
+			return err
+		}
+		return binary.Write(w, binary.BigEndian, x)
+	}
+	
+	return fmt.Errorf("Cannot write value of type %T as NBT", value)
+}
@@ -0,0 +1,523 @@
+// Command packetgen generates packet types from a JSON schema.
+//
+// Usage:
+//
+//     packetgen [-o output.go] [-test output_test.go] schema.json
+//
+// It is normally run by go generate in the packets package. The schema looks
+// like this:
+//
+//     {
+//         "package": "packets",
+//         "versions": ["V1_7_10", "V1_8", "V1_12_2"],
+//         "packets": [
+//             {
+//                 "name": "StatusPing",
+//                 "state": "Status",
+//                 "direction": "Serverbound",
+//                 "id": 1,
+//                 "fields": [
+//                     {"name": "Payload", "type": "int64"}
+//                 ]
+//             },
+//             {
+//                 "name": "Disconnect",
+//                 "doc": "Disconnect is sent to kick the player.",
+//                 "state": "Play",
+//                 "direction": "Clientbound",
+//                 "versions": ["V1_7_10", "V1_8", "V1_12_2"],
+//                 "fields": [
+//                     {"name": "Reason", "type": "string"}
+//                 ]
+//             }
+//         ]
+//     }
+//
+// Packets must be in the Status or Play state, as those are the only packets
+// the proxy passes to handlers.
+// Versions are the names of protocol version constants in the generated
+// package, oldest first. Status packets have the same id in every protocol
+// version, including those not listed. Play packets have no id: their numbers
+// are looked up by name in the proxy's table of Play packet numbers (see
+// proxy.PlayNumbers) when the package is initialised. Instead they list the
+// versions they exist in, which the generated tests check against that table.
+// A field may be limited to a range of versions with "since" (inclusive) and
+// "before" (exclusive); a field may be listed more than once with different
+// types in non-overlapping ranges, as long as they have the same Go type.
+//
+// Field types are bool, uint8, uint16, uint32, uint64, int8, int16, int32,
+// int64, varint, string (with an optional "max" length), uuid (a UUID sent as
+// 16 bytes, held as a string), varbytes (a byte array prefixed with a varint
+// length), shortbytes (prefixed with a uint16 length) and bytes (the rest of
+// the packet).
+//
+// The generated code uses the helpers readBinaryUUID, writeBinaryUUID,
+// readShortBytes, writeShortBytes and playNumbers, and the numbers type with
+// its id and latestID methods, which the package must define.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+type protocolSchema struct {
+	Package string `json:"package"`
+	Versions []string `json:"versions"`
+	Packets []*packetSchema `json:"packets"`
+}
+
+type packetSchema struct {
+	Name string `json:"name"`
+	Doc string `json:"doc"`
+	State string `json:"state"`
+	Direction string `json:"direction"`
+	ID *uint64 `json:"id"`
+	Versions []string `json:"versions"`
+	Fields []*fieldSchema `json:"fields"`
+}
+
+type fieldSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Max int `json:"max"`
+	Since string `json:"since"`
+	Before string `json:"before"`
+}
+
+// A fieldType describes how to declare, read and write a field type. read is
+// the expression reading the field, write is a format string taking the field
+// value, and sample is a value used in the generated tests.
+type fieldType struct {
+	goType string
+	read string
+	write string
+	sample string
+}
+
+var fieldTypes = map[string]fieldType{
+	"bool": {"bool", "r.ReadBool()", "w.WriteBool(%s)", "true"},
+	"uint8": {"uint8", "r.ReadUint8()", "w.WriteUint8(%s)", "1"},
+	"uint16": {"uint16", "r.ReadUint16()", "w.WriteUint16(%s)", "2"},
+	"uint32": {"uint32", "r.ReadUint32()", "w.WriteUint32(%s)", "3"},
+	"uint64": {"uint64", "r.ReadUint64()", "w.WriteUint64(%s)", "4"},
+	"int8": {"int8", "r.ReadInt8()", "w.WriteInt8(%s)", "-1"},
+	"int16": {"int16", "r.ReadInt16()", "w.WriteInt16(%s)", "-2"},
+	"int32": {"int32", "r.ReadInt32()", "w.WriteInt32(%s)", "-3"},
+	"int64": {"int64", "r.ReadInt64()", "w.WriteInt64(%s)", "-4"},
+	"varint": {"uint64", "r.ReadVarint()", "w.WriteVarint(%s)", "300"},
+	"string": {"string", "r.ReadString()", "w.WriteString(%s)", `"text"`},
+	"uuid": {"string", "readBinaryUUID(r)", "writeBinaryUUID(w, %s)", `"01234567-89ab-cdef-0123-456789abcdef"`},
+	"varbytes": {"[]byte", "r.ReadByteArray(proxy.MaxPacketLength)", "w.WriteByteArray(%s)", "[]byte{1, 2, 3}"},
+	"shortbytes": {"[]byte", "readShortBytes(r)", "writeShortBytes(w, %s)", "[]byte{1, 2, 3}"},
+	"bytes": {"[]byte", "r.ReadRemaining()", "w.WriteBytes(%s)", "[]byte{1, 2, 3}"},
+}
+
+func main() {
+	output := flag.String("o", "", "File to write the packet types to (default standard output)")
+	testOutput := flag.String("test", "", "File to write round-trip tests to (default none)")
+	flag.Parse()
+	
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: packetgen [-o output.go] [-test output_test.go] schema.json\n")
+		os.Exit(2)
+	}
+	
+	schemaFile := flag.Arg(0)
+	
+	schema, err := readSchema(schemaFile)
+	if err != nil {
+		log.Fatalf("%s: %s", schemaFile, err.Error())
+	}
+	
+	src, err := generate(schema, schemaFile)
+	if err != nil {
+		log.Fatalf("%s: %s", schemaFile, err.Error())
+	}
+	
+	err = writeOutput(*output, src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	if *testOutput != "" {
+		err = writeOutput(*testOutput, generateTests(schema, schemaFile))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func readSchema(filename string) (schema *protocolSchema, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	
+	schema = &protocolSchema{}
+	err = json.Unmarshal(data, schema)
+	if err != nil {
+		return nil, err
+	}
+	
+	if schema.Package == "" {
+		return nil, fmt.Errorf("No package name given")
+	}
+	
+	return schema, nil
+}
+
+func writeOutput(filename string, src []byte) (err error) {
+	if filename == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	
+	return ioutil.WriteFile(filename, src, 0644)
+}
+
+// versionIndex returns the position of a version in the schema's version
+// list, or -1 if it is not listed.
+func (schema *protocolSchema) versionIndex(version string) int {
+	for i, v := range schema.Versions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// packetVersions returns the versions a packet exists in out of those listed in
+// the schema, oldest first.
+func (schema *protocolSchema) packetVersions(packet *packetSchema) (versions []string) {
+	if packet.State == "Status" {
+		return schema.Versions
+	}
+	
+	for _, v := range schema.Versions {
+		for _, pv := range packet.Versions {
+			if v == pv {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions
+}
+
+// inVersion returns true if the field is sent in the given version.
+func (schema *protocolSchema) inVersion(field *fieldSchema, version string) bool {
+	i := schema.versionIndex(version)
+	if field.Since != "" && i < schema.versionIndex(field.Since) {
+		return false
+	}
+	if field.Before != "" && i >= schema.versionIndex(field.Before) {
+		return false
+	}
+	return true
+}
+
+// structFields returns the distinct fields of a packet in the order they
+// first appear.
+func structFields(packet *packetSchema) (names []string, types map[string]string, err error) {
+	types = make(map[string]string)
+	
+	for _, field := range packet.Fields {
+		ft, ok := fieldTypes[field.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s.%s: unknown type %q", packet.Name, field.Name, field.Type)
+		}
+		
+		goType, seen := types[field.Name]
+		if !seen {
+			names = append(names, field.Name)
+			types[field.Name] = ft.goType
+		} else if goType != ft.goType {
+			return nil, nil, fmt.Errorf("%s.%s: declared as both %s and %s", packet.Name, field.Name, goType, ft.goType)
+		}
+	}
+	
+	return names, types, nil
+}
+
+func (schema *protocolSchema) check(packet *packetSchema) (err error) {
+	if packet.Name == "" {
+		return fmt.Errorf("Packet with no name")
+	}
+	
+	// Handlers only see packets in the Status and Play states.
+	if packet.State != "Status" && packet.State != "Play" {
+		return fmt.Errorf("%s: packets in state %s are not passed to handlers", packet.Name, packet.State)
+	}
+	
+	if packet.State == "Play" && packet.ID != nil {
+		return fmt.Errorf("%s: Play packets take their IDs from the proxy", packet.Name)
+	}
+	
+	if packet.State == "Status" && packet.ID == nil {
+		return fmt.Errorf("%s: no ID given", packet.Name)
+	}
+	
+	if packet.State == "Status" && len(packet.Versions) != 0 {
+		return fmt.Errorf("%s: Status packets exist in every version", packet.Name)
+	}
+	
+	if packet.State == "Play" && len(packet.Versions) == 0 {
+		return fmt.Errorf("%s: no versions given", packet.Name)
+	}
+	
+	for _, v := range packet.Versions {
+		if schema.versionIndex(v) < 0 {
+			return fmt.Errorf("%s: unknown version %s", packet.Name, v)
+		}
+	}
+	
+	for _, field := range packet.Fields {
+		for _, v := range []string{field.Since, field.Before} {
+			if v != "" && schema.versionIndex(v) < 0 {
+				return fmt.Errorf("%s.%s: unknown version %s", packet.Name, field.Name, v)
+			}
+		}
+		
+		if field.Max != 0 && field.Type != "string" {
+			return fmt.Errorf("%s.%s: max is only allowed on strings", packet.Name, field.Name)
+		}
+	}
+	
+	return nil
+}
+
+// condition returns the Go expression testing whether a field is sent, or ""
+// if it always is. v is the reader or writer variable.
+func condition(field *fieldSchema, v string) string {
+	var conds []string
+	if field.Since != "" {
+		conds = append(conds, fmt.Sprintf("%s.ProtocolVersion() >= %s", v, field.Since))
+	}
+	if field.Before != "" {
+		conds = append(conds, fmt.Sprintf("%s.ProtocolVersion() < %s", v, field.Before))
+	}
+	return strings.Join(conds, " && ")
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func header(buf *bytes.Buffer, schema *protocolSchema, schemaFile string) {
+	fmt.Fprintf(buf, "// Code generated by packetgen from %s. DO NOT EDIT.\n\n", schemaFile)
+	fmt.Fprintf(buf, "package %s\n\n", schema.Package)
+}
+
+func generate(schema *protocolSchema, schemaFile string) (src []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	header(buf, schema, schemaFile)
+	
+	buf.WriteString("import (\n\t\"github.com/kierdavis/proxy\"\n)\n")
+	
+	for _, packet := range schema.Packets {
+		err = schema.check(packet)
+		if err != nil {
+			return nil, err
+		}
+		
+		err = schema.generatePacket(buf, packet)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	return buf.Bytes(), nil
+}
+
+func (schema *protocolSchema) generatePacket(buf *bytes.Buffer, packet *packetSchema) (err error) {
+	names, types, err := structFields(packet)
+	if err != nil {
+		return err
+	}
+	
+	numbersVar := lowerFirst(packet.Name) + "Numbers"
+	
+	buf.WriteString("\n")
+	if packet.Doc != "" {
+		for _, line := range strings.Split(strings.TrimSpace(packet.Doc), "\n") {
+			fmt.Fprintf(buf, "// %s\n", line)
+		}
+	}
+	
+	fmt.Fprintf(buf, "type %s struct {\n", packet.Name)
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t%s %s\n", name, types[name])
+	}
+	buf.WriteString("}\n\n")
+	
+	if packet.State == "Status" {
+		fmt.Fprintf(buf, "func (packet *%s) ID() (id proxy.PacketID) {\n", packet.Name)
+		fmt.Fprintf(buf, "\treturn proxy.PacketID{State: proxy.%s, Direction: proxy.%s, Number: 0x%02X}\n", packet.State, packet.Direction, *packet.ID)
+		buf.WriteString("}\n\n")
+		
+		fmt.Fprintf(buf, "func (packet *%s) VersionID(version uint64) (id proxy.PacketID, ok bool) {\n", packet.Name)
+		buf.WriteString("\treturn packet.ID(), true\n")
+		buf.WriteString("}\n\n")
+		
+	} else {
+		fmt.Fprintf(buf, "var %s = playNumbers(%q)\n\n", numbersVar, packet.Name)
+		
+		fmt.Fprintf(buf, "func (packet *%s) ID() (id proxy.PacketID) {\n", packet.Name)
+		fmt.Fprintf(buf, "\treturn %s.latestID(proxy.%s, proxy.%s)\n", numbersVar, packet.State, packet.Direction)
+		buf.WriteString("}\n\n")
+		
+		fmt.Fprintf(buf, "func (packet *%s) VersionID(version uint64) (id proxy.PacketID, ok bool) {\n", packet.Name)
+		fmt.Fprintf(buf, "\treturn %s.id(proxy.%s, proxy.%s, version)\n", numbersVar, packet.State, packet.Direction)
+		buf.WriteString("}\n\n")
+	}
+	
+	fmt.Fprintf(buf, "func (packet *%s) Read(r proxy.BinaryReader) (err error) {\n", packet.Name)
+	for _, field := range packet.Fields {
+		ft := fieldTypes[field.Type]
+		read := ft.read
+		if field.Type == "string" && field.Max != 0 {
+			read = fmt.Sprintf("r.ReadStringMax(%d)", field.Max)
+		}
+		
+		indent := "\t"
+		cond := condition(field, "r")
+		if cond != "" {
+			fmt.Fprintf(buf, "\tif %s {\n", cond)
+			indent = "\t\t"
+		}
+		
+		fmt.Fprintf(buf, "%spacket.%s, err = %s\n", indent, field.Name, read)
+		fmt.Fprintf(buf, "%sif err != nil {\n", indent)
+		fmt.Fprintf(buf, "%s\treturn proxy.FieldError(%q, err)\n", indent, field.Name)
+		fmt.Fprintf(buf, "%s}\n", indent)
+		
+		if cond != "" {
+			buf.WriteString("\t}\n")
+		}
+		buf.WriteString("\t\n")
+	}
+	buf.WriteString("\treturn nil\n}\n\n")
+	
+	fmt.Fprintf(buf, "func (packet *%s) Write(w proxy.BinaryWriter) (err error) {\n", packet.Name)
+	for _, field := range packet.Fields {
+		ft := fieldTypes[field.Type]
+		
+		indent := "\t"
+		cond := condition(field, "w")
+		if cond != "" {
+			fmt.Fprintf(buf, "\tif %s {\n", cond)
+			indent = "\t\t"
+		}
+		
+		fmt.Fprintf(buf, "%serr = %s\n", indent, fmt.Sprintf(ft.write, "packet."+field.Name))
+		fmt.Fprintf(buf, "%sif err != nil {\n", indent)
+		fmt.Fprintf(buf, "%s\treturn err\n", indent)
+		fmt.Fprintf(buf, "%s}\n", indent)
+		
+		if cond != "" {
+			buf.WriteString("\t}\n")
+		}
+		buf.WriteString("\t\n")
+	}
+	buf.WriteString("\treturn nil\n}\n")
+	
+	return nil
+}
+
+// generateTests generates a test that writes and reads back a packet of each
+// type in each version it exists in, failing if the packet has no ID in one of
+// them. Play packets are also checked to have no ID in the schema's versions
+// they are not listed in, so that their lists agree with the proxy's table.
+func generateTests(schema *protocolSchema, schemaFile string) (src []byte) {
+	buf := bytes.NewBuffer(nil)
+	header(buf, schema, schemaFile)
+	
+	buf.WriteString("import (\n\t\"bytes\"\n\t\"reflect\"\n\t\"testing\"\n\t\n\t\"github.com/kierdavis/proxy\"\n)\n\n")
+	
+	buf.WriteString("var roundTripTests = []struct {\n\tversion uint64\n\tpacket proxy.Packet\n}{\n")
+	for _, packet := range schema.Packets {
+		for _, v := range schema.packetVersions(packet) {
+			var values []string
+			seen := make(map[string]bool)
+			
+			for _, field := range packet.Fields {
+				if seen[field.Name] || !schema.inVersion(field, v) {
+					continue
+				}
+				seen[field.Name] = true
+				
+				values = append(values, fmt.Sprintf("%s: %s", field.Name, fieldTypes[field.Type].sample))
+			}
+			
+			fmt.Fprintf(buf, "\t{%s, &%s{%s}},\n", v, packet.Name, strings.Join(values, ", "))
+		}
+	}
+	buf.WriteString("}\n\n")
+	
+	buf.WriteString("var unsupportedTests = []struct {\n\tversion uint64\n\tpacket proxy.Packet\n}{\n")
+	for _, packet := range schema.Packets {
+		listed := make(map[string]bool)
+		for _, v := range schema.packetVersions(packet) {
+			listed[v] = true
+		}
+		
+		for _, v := range schema.Versions {
+			if !listed[v] {
+				fmt.Fprintf(buf, "\t{%s, &%s{}},\n", v, packet.Name)
+			}
+		}
+	}
+	buf.WriteString("}\n\n")
+	
+	buf.WriteString(`func TestRoundTrip(t *testing.T) {
+	for _, test := range roundTripTests {
+		_, ok := test.packet.(proxy.VersionedPacket).VersionID(test.version)
+		if !ok {
+			t.Errorf("%T (version %d): not supported, but listed in the schema", test.packet, test.version)
+			continue
+		}
+		
+		buf := bytes.NewBuffer(nil)
+		
+		err := test.packet.Write(proxy.NewVersionedBinaryWriter(buf, test.version))
+		if err != nil {
+			t.Errorf("%T (version %d): write failed: %s", test.packet, test.version, err.Error())
+			continue
+		}
+		
+		packet := reflect.New(reflect.TypeOf(test.packet).Elem()).Interface().(proxy.Packet)
+		
+		err = packet.Read(proxy.NewVersionedBinaryReader(buf, test.version))
+		if err != nil {
+			t.Errorf("%T (version %d): read failed: %s", test.packet, test.version, err.Error())
+			continue
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%T (version %d): %d bytes left unread", test.packet, test.version, buf.Len())
+		}
+		
+		if !reflect.DeepEqual(packet, test.packet) {
+			t.Errorf("%T (version %d): got %+v, expected %+v", test.packet, test.version, packet, test.packet)
+		}
+	}
+}
+
+func TestUnsupportedVersions(t *testing.T) {
+	for _, test := range unsupportedTests {
+		_, ok := test.packet.(proxy.VersionedPacket).VersionID(test.version)
+		if ok {
+			t.Errorf("%T (version %d): supported, but not listed in the schema", test.packet, test.version)
+		}
+	}
+}
+`)
+
+	return buf.Bytes()
+}
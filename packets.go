@@ -1,5 +1,9 @@
 package proxy
 
+import (
+	"fmt"
+)
+
 type HS0HandshakePacket struct {
 	ProtocolVersion uint64
 	ServerAddress string
@@ -11,18 +15,223 @@ func (packet *HS0HandshakePacket) ID() (id PacketID) {
 	return PacketID{Handshaking, Serverbound, 0x0}
 }
 
-func (packet *HS0HandshakePacket) Read(r BinaryReader) {
-	packet.ProtocolVersion, _ = r.ReadVarint()
-	packet.ServerAddress, _   = r.ReadString()
-	packet.ServerPort, _      = r.ReadUint16()
-	packet.NextState, _       = r.ReadVarint()
+func (packet *HS0HandshakePacket) Read(r BinaryReader) (err error) {
+	packet.ProtocolVersion, err = r.ReadVarint()
+	if err != nil {
+		return FieldError("ProtocolVersion", err)
+	}
+	
+	packet.ServerAddress, err = r.ReadStringMax(255)
+	if err != nil {
+		return FieldError("ServerAddress", err)
+	}
+	
+	packet.ServerPort, err = r.ReadUint16()
+	if err != nil {
+		return FieldError("ServerPort", err)
+	}
+	
+	packet.NextState, err = r.ReadVarint()
+	if err != nil {
+		return FieldError("NextState", err)
+	}
+	
+	return nil
+}
+
+func (packet *HS0HandshakePacket) Write(w BinaryWriter) (err error) {
+	err = w.WriteVarint(packet.ProtocolVersion)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteString(packet.ServerAddress)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint16(packet.ServerPort)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteVarint(packet.NextState)
+}
+
+// Protocol versions in which Join Game changed. Join Game and Respawn are only
+// known up to 1.12.2, as listed in playNumbers.
+const (
+	// 1.8: the reduced debug info flag is added.
+	joinGameDebugInfoVersion = 47
+	
+	// 1.9.1: the dimension is sent as an int32 rather than an int8.
+	joinGameIntDimensionVersion = 108
+)
+
+type PC1JoinGamePacket struct {
+	EntityID int32
+	Gamemode uint8
+	Dimension int32
+	Difficulty uint8
+	MaxPlayers uint8
+	LevelType string
+	ReducedDebugInfo bool
+}
+
+func (packet *PC1JoinGamePacket) ID() (id PacketID) {
+	return PacketID{Play, Clientbound, 0x1}
+}
+
+func (packet *PC1JoinGamePacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return playID("JoinGame", Clientbound, version)
+}
+
+func (packet *PC1JoinGamePacket) Read(r BinaryReader) (err error) {
+	version := r.ProtocolVersion()
+	
+	packet.EntityID, err = r.ReadInt32()
+	if err != nil {
+		return FieldError("EntityID", err)
+	}
+	
+	packet.Gamemode, err = r.ReadUint8()
+	if err != nil {
+		return FieldError("Gamemode", err)
+	}
+	
+	if version >= joinGameIntDimensionVersion {
+		packet.Dimension, err = r.ReadInt32()
+	} else {
+		var dimension int8
+		dimension, err = r.ReadInt8()
+		packet.Dimension = int32(dimension)
+	}
+	if err != nil {
+		return FieldError("Dimension", err)
+	}
+	
+	packet.Difficulty, err = r.ReadUint8()
+	if err != nil {
+		return FieldError("Difficulty", err)
+	}
+	
+	packet.MaxPlayers, err = r.ReadUint8()
+	if err != nil {
+		return FieldError("MaxPlayers", err)
+	}
+	
+	packet.LevelType, err = r.ReadStringMax(16)
+	if err != nil {
+		return FieldError("LevelType", err)
+	}
+	
+	packet.ReducedDebugInfo = false
+	if version >= joinGameDebugInfoVersion {
+		packet.ReducedDebugInfo, err = r.ReadBool()
+		if err != nil {
+			return FieldError("ReducedDebugInfo", err)
+		}
+	}
+	
+	return nil
+}
+
+func (packet *PC1JoinGamePacket) Write(w BinaryWriter) (err error) {
+	version := w.ProtocolVersion()
+	
+	err = w.WriteInt32(packet.EntityID)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Gamemode)
+	if err != nil {
+		return err
+	}
+	
+	if version >= joinGameIntDimensionVersion {
+		err = w.WriteInt32(packet.Dimension)
+	} else {
+		err = w.WriteInt8(int8(packet.Dimension))
+	}
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Difficulty)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.MaxPlayers)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteString(packet.LevelType)
+	if err != nil || version < joinGameDebugInfoVersion {
+		return err
+	}
+	
+	return w.WriteBool(packet.ReducedDebugInfo)
 }
 
-func (packet *HS0HandshakePacket) Write(w BinaryWriter) {
-	w.WriteVarint(packet.ProtocolVersion)
-	w.WriteString(packet.ServerAddress)
-	w.WriteUint16(packet.ServerPort)
-	w.WriteVarint(packet.NextState)
+type PC7RespawnPacket struct {
+	Dimension int32
+	Difficulty uint8
+	Gamemode uint8
+	LevelType string
+}
+
+func (packet *PC7RespawnPacket) ID() (id PacketID) {
+	return PacketID{Play, Clientbound, 0x7}
+}
+
+func (packet *PC7RespawnPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return playID("Respawn", Clientbound, version)
+}
+
+func (packet *PC7RespawnPacket) Read(r BinaryReader) (err error) {
+	packet.Dimension, err = r.ReadInt32()
+	if err != nil {
+		return FieldError("Dimension", err)
+	}
+	
+	packet.Difficulty, err = r.ReadUint8()
+	if err != nil {
+		return FieldError("Difficulty", err)
+	}
+	
+	packet.Gamemode, err = r.ReadUint8()
+	if err != nil {
+		return FieldError("Gamemode", err)
+	}
+	
+	packet.LevelType, err = r.ReadStringMax(16)
+	if err != nil {
+		return FieldError("LevelType", err)
+	}
+	
+	return nil
+}
+
+func (packet *PC7RespawnPacket) Write(w BinaryWriter) (err error) {
+	err = w.WriteInt32(packet.Dimension)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Difficulty)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Gamemode)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteString(packet.LevelType)
 }
 
 type PC40DisconnectPacket struct {
@@ -33,12 +242,89 @@ func (packet *PC40DisconnectPacket) ID() (id PacketID) {
 	return PacketID{Play, Clientbound, 0x40}
 }
 
-func (packet *PC40DisconnectPacket) Read(r BinaryReader) {
-	packet.JsonData, _ = r.ReadString()
+func (packet *PC40DisconnectPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return playID("Disconnect", Clientbound, version)
+}
+
+func (packet *PC40DisconnectPacket) Read(r BinaryReader) (err error) {
+	packet.JsonData, err = r.ReadString()
+	if err != nil {
+		return FieldError("JsonData", err)
+	}
+	
+	return nil
 }
 
-func (packet *PC40DisconnectPacket) Write(w BinaryWriter) {
-	w.WriteString(packet.JsonData)
+func (packet *PC40DisconnectPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteString(packet.JsonData)
+}
+
+// Protocol versions in which the Login packets changed.
+const (
+	// 1.8: the byte arrays in the encryption packets are prefixed with a
+	// varint length rather than a uint16, and Set Compression is added.
+	loginVarintArraysVersion = 47
+	
+	// 1.13: Login Plugin Request and Response are added.
+	loginPluginVersion = 393
+	
+	// 1.16: Login Success sends the UUID as 16 bytes rather than a string.
+	loginBinaryUUIDVersion = 735
+	
+	// 1.19: Login Start carries the player's chat signing key, Login Success
+	// carries their profile properties, and Encryption Response may carry a
+	// signature in place of the verify token.
+	loginSigningVersion = 759
+	
+	// 1.19.1: Login Start may carry the player's UUID.
+	loginStartUUIDVersion = 760
+	
+	// 1.19.3: chat signing keys are no longer sent during login.
+	loginUnsignedVersion = 761
+	
+	// 1.20.2: Login Start always carries the player's UUID.
+	loginRequiredUUIDVersion = 764
+	
+	// 1.20.5: Encryption Request and Login Success gain fields that are not
+	// supported.
+	loginUnsupportedVersion = 766
+)
+
+// loginID returns the ID of a Login packet, which has the same number in every
+// version from the one it was added in.
+func loginID(dir Direction, number uint64, since uint64, version uint64) (id PacketID, ok bool) {
+	return PacketID{Login, dir, number}, version >= since && version < loginUnsupportedVersion
+}
+
+// readLoginBytes reads a byte array from one of the encryption packets.
+func readLoginBytes(r BinaryReader) (buf []byte, err error) {
+	if r.ProtocolVersion() >= loginVarintArraysVersion {
+		return r.ReadByteArray(MaxPacketLength)
+	}
+	
+	length, err := r.ReadUint16()
+	if err != nil {
+		return nil, err
+	}
+	
+	return r.ReadBytes(int(length))
+}
+
+func writeLoginBytes(w BinaryWriter, buf []byte) (err error) {
+	if w.ProtocolVersion() >= loginVarintArraysVersion {
+		return w.WriteByteArray(buf)
+	}
+	
+	if len(buf) > 0xffff {
+		return fmt.Errorf("Array length %d exceeds maximum of %d", len(buf), 0xffff)
+	}
+	
+	err = w.WriteUint16(uint16(len(buf)))
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(buf)
 }
 
 type LC0DisconnectPacket struct {
@@ -46,15 +332,20 @@ type LC0DisconnectPacket struct {
 }
 
 func (packet *LC0DisconnectPacket) ID() (id PacketID) {
-	return PacketID{Login, Clientbound, 0x40}
+	return PacketID{Login, Clientbound, 0x0}
 }
 
-func (packet *LC0DisconnectPacket) Read(r BinaryReader) {
-	packet.JsonData, _ = r.ReadString()
+func (packet *LC0DisconnectPacket) Read(r BinaryReader) (err error) {
+	packet.JsonData, err = r.ReadString()
+	if err != nil {
+		return FieldError("JsonData", err)
+	}
+	
+	return nil
 }
 
-func (packet *LC0DisconnectPacket) Write(w BinaryWriter) {
-	w.WriteString(packet.JsonData)
+func (packet *LC0DisconnectPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteString(packet.JsonData)
 }
 
 type LC1EncryptionRequestPacket struct {
@@ -67,76 +358,563 @@ func (packet *LC1EncryptionRequestPacket) ID() (id PacketID) {
 	return PacketID{Login, Clientbound, 0x1}
 }
 
-func (packet *LC1EncryptionRequestPacket) Read(r BinaryReader) {
-	packet.ServerID, _    = r.ReadString()
-	publicKeyLength, _   := r.ReadUint16()
-	packet.PublicKey, _   = r.ReadBytes(int(publicKeyLength))
-	verifyTokenLength, _ := r.ReadUint16()
-	packet.VerifyToken, _ = r.ReadBytes(int(verifyTokenLength))
+func (packet *LC1EncryptionRequestPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Clientbound, 0x1, 0, version)
 }
 
-func (packet *LC1EncryptionRequestPacket) Write(w BinaryWriter) {
-	w.WriteString(packet.ServerID)
-	w.WriteUint16(uint16(len(packet.PublicKey)))
-	w.WriteBytes(packet.PublicKey)
-	w.WriteUint16(uint16(len(packet.VerifyToken)))
-	w.WriteBytes(packet.VerifyToken)
+func (packet *LC1EncryptionRequestPacket) Read(r BinaryReader) (err error) {
+	packet.ServerID, err = r.ReadStringMax(20)
+	if err != nil {
+		return FieldError("ServerID", err)
+	}
+	
+	packet.PublicKey, err = readLoginBytes(r)
+	if err != nil {
+		return FieldError("PublicKey", err)
+	}
+	
+	packet.VerifyToken, err = readLoginBytes(r)
+	if err != nil {
+		return FieldError("VerifyToken", err)
+	}
+	
+	return nil
 }
 
+func (packet *LC1EncryptionRequestPacket) Write(w BinaryWriter) (err error) {
+	err = w.WriteString(packet.ServerID)
+	if err != nil {
+		return err
+	}
+	
+	err = writeLoginBytes(w, packet.PublicKey)
+	if err != nil {
+		return err
+	}
+	
+	return writeLoginBytes(w, packet.VerifyToken)
+}
+
+// LC2LoginSuccessPacket holds the player's UUID in its hyphenated form, although
+// it is sent as 16 bytes from 1.16 onwards. Properties are only sent from 1.19
+// onwards.
 type LC2LoginSuccessPacket struct {
 	UUID string
 	Username string
+	Properties []ProfileProperty
 }
 
 func (packet *LC2LoginSuccessPacket) ID() (id PacketID) {
 	return PacketID{Login, Clientbound, 0x2}
 }
 
-func (packet *LC2LoginSuccessPacket) Read(r BinaryReader) {
-	packet.UUID, _     = r.ReadString()
-	packet.Username, _ = r.ReadString()
+func (packet *LC2LoginSuccessPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Clientbound, 0x2, 0, version)
+}
+
+func (packet *LC2LoginSuccessPacket) Read(r BinaryReader) (err error) {
+	if r.ProtocolVersion() >= loginBinaryUUIDVersion {
+		var uuid UUID
+		uuid, err = r.ReadUUID()
+		packet.UUID = uuid.String()
+	} else {
+		packet.UUID, err = r.ReadStringMax(36)
+	}
+	if err != nil {
+		return FieldError("UUID", err)
+	}
+	
+	packet.Username, err = r.ReadStringMax(16)
+	if err != nil {
+		return FieldError("Username", err)
+	}
+	
+	packet.Properties = nil
+	if r.ProtocolVersion() < loginSigningVersion {
+		return nil
+	}
+	
+	_, err = r.ReadArray(MaxPacketLength, func(i int) (err error) {
+		var property ProfileProperty
+		property.Name, err = r.ReadString()
+		if err != nil {
+			return err
+		}
+		
+		property.Value, err = r.ReadString()
+		if err != nil {
+			return err
+		}
+		
+		signed, err := r.ReadBool()
+		if err == nil && signed {
+			property.Signature, err = r.ReadString()
+		}
+		if err != nil {
+			return err
+		}
+		
+		packet.Properties = append(packet.Properties, property)
+		return nil
+	})
+	if err != nil {
+		return FieldError("Properties", err)
+	}
+	
+	return nil
+}
+
+func (packet *LC2LoginSuccessPacket) Write(w BinaryWriter) (err error) {
+	if w.ProtocolVersion() >= loginBinaryUUIDVersion {
+		var uuid UUID
+		uuid, err = ParseUUID(packet.UUID)
+		if err == nil {
+			err = w.WriteUUID(uuid)
+		}
+	} else {
+		err = w.WriteString(packet.UUID)
+	}
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteString(packet.Username)
+	if err != nil || w.ProtocolVersion() < loginSigningVersion {
+		return err
+	}
+	
+	return w.WriteArray(len(packet.Properties), func(i int) (err error) {
+		property := packet.Properties[i]
+		err = w.WriteString(property.Name)
+		if err != nil {
+			return err
+		}
+		
+		err = w.WriteString(property.Value)
+		if err != nil {
+			return err
+		}
+		
+		err = w.WriteBool(property.Signature != "")
+		if err != nil || property.Signature == "" {
+			return err
+		}
+		
+		return w.WriteString(property.Signature)
+	})
+}
+
+// LC3SetCompressionPacket turns compression off if Threshold is negative.
+type LC3SetCompressionPacket struct {
+	Threshold int32
+}
+
+func (packet *LC3SetCompressionPacket) ID() (id PacketID) {
+	return PacketID{Login, Clientbound, 0x3}
+}
+
+func (packet *LC3SetCompressionPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Clientbound, 0x3, loginVarintArraysVersion, version)
+}
+
+func (packet *LC3SetCompressionPacket) Read(r BinaryReader) (err error) {
+	packet.Threshold, err = r.ReadVarint32()
+	if err != nil {
+		return FieldError("Threshold", err)
+	}
+	
+	return nil
+}
+
+func (packet *LC3SetCompressionPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteVarint32(packet.Threshold)
+}
+
+type LC4LoginPluginRequestPacket struct {
+	MessageID uint64
+	Channel string
+	Data []byte
+}
+
+func (packet *LC4LoginPluginRequestPacket) ID() (id PacketID) {
+	return PacketID{Login, Clientbound, 0x4}
+}
+
+func (packet *LC4LoginPluginRequestPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Clientbound, 0x4, loginPluginVersion, version)
 }
 
-func (packet *LC2LoginSuccessPacket) Write(w BinaryWriter) {
-	w.WriteString(packet.UUID)
-	w.WriteString(packet.Username)
+func (packet *LC4LoginPluginRequestPacket) Read(r BinaryReader) (err error) {
+	packet.MessageID, err = r.ReadVarint()
+	if err != nil {
+		return FieldError("MessageID", err)
+	}
+	
+	packet.Channel, err = r.ReadString()
+	if err != nil {
+		return FieldError("Channel", err)
+	}
+	
+	packet.Data, err = r.ReadRemaining()
+	if err != nil {
+		return FieldError("Data", err)
+	}
+	
+	return nil
 }
 
+func (packet *LC4LoginPluginRequestPacket) Write(w BinaryWriter) (err error) {
+	err = w.WriteVarint(packet.MessageID)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteString(packet.Channel)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(packet.Data)
+}
+
+// LoginKey is a player's chat signing key, sent in Login Start by 1.19 and
+// 1.19.1 clients.
+type LoginKey struct {
+	ExpiresAt int64
+	PublicKey []byte
+	Signature []byte
+}
+
+// LS0LoginStartPacket carries the player's chat signing key in 1.19 and 1.19.1
+// if the client has one, and their UUID from 1.19.1 onwards if the client
+// chooses to send it (which it always does from 1.20.2). Key is nil and UUID is
+// empty when they are not sent.
 type LS0LoginStartPacket struct {
 	Name string
+	Key *LoginKey
+	UUID string
 }
 
 func (packet *LS0LoginStartPacket) ID() (id PacketID) {
 	return PacketID{Login, Serverbound, 0x0}
 }
 
-func (packet *LS0LoginStartPacket) Read(r BinaryReader) {
-	packet.Name, _ = r.ReadString()
+func (packet *LS0LoginStartPacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Serverbound, 0x0, 0, version)
+}
+
+func (packet *LS0LoginStartPacket) Read(r BinaryReader) (err error) {
+	version := r.ProtocolVersion()
+	
+	packet.Name, err = r.ReadStringMax(16)
+	if err != nil {
+		return FieldError("Name", err)
+	}
+	
+	packet.Key, packet.UUID = nil, ""
+	
+	if version >= loginSigningVersion && version < loginUnsignedVersion {
+		hasKey, err := r.ReadBool()
+		if err != nil {
+			return FieldError("Key", err)
+		}
+		
+		if hasKey {
+			packet.Key = &LoginKey{}
+			packet.Key.ExpiresAt, err = r.ReadInt64()
+			if err == nil {
+				packet.Key.PublicKey, err = r.ReadByteArray(MaxPacketLength)
+			}
+			if err == nil {
+				packet.Key.Signature, err = r.ReadByteArray(MaxPacketLength)
+			}
+			if err != nil {
+				return FieldError("Key", err)
+			}
+		}
+	}
+	
+	if version < loginStartUUIDVersion {
+		return nil
+	}
+	
+	hasUUID := true
+	if version < loginRequiredUUIDVersion {
+		hasUUID, err = r.ReadBool()
+		if err != nil {
+			return FieldError("UUID", err)
+		}
+	}
+	
+	if hasUUID {
+		uuid, err := r.ReadUUID()
+		if err != nil {
+			return FieldError("UUID", err)
+		}
+		
+		packet.UUID = uuid.String()
+	}
+	
+	return nil
 }
 
-func (packet *LS0LoginStartPacket) Write(w BinaryWriter) {
-	w.WriteString(packet.Name)
+func (packet *LS0LoginStartPacket) Write(w BinaryWriter) (err error) {
+	version := w.ProtocolVersion()
+	
+	err = w.WriteString(packet.Name)
+	if err != nil {
+		return err
+	}
+	
+	if version >= loginSigningVersion && version < loginUnsignedVersion {
+		err = w.WriteBool(packet.Key != nil)
+		if err == nil && packet.Key != nil {
+			err = w.WriteInt64(packet.Key.ExpiresAt)
+			if err == nil {
+				err = w.WriteByteArray(packet.Key.PublicKey)
+			}
+			if err == nil {
+				err = w.WriteByteArray(packet.Key.Signature)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	
+	if version < loginStartUUIDVersion {
+		return nil
+	}
+	
+	if version < loginRequiredUUIDVersion {
+		err = w.WriteBool(packet.UUID != "")
+		if err != nil || packet.UUID == "" {
+			return err
+		}
+	}
+	
+	var uuid UUID
+	if packet.UUID != "" {
+		uuid, err = ParseUUID(packet.UUID)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return w.WriteUUID(uuid)
 }
 
+// LS1EncryptionResponsePacket may carry a salt and signature made with the
+// player's chat signing key in place of the verify token in 1.19 and 1.19.1, in
+// which case EncryptedVerifyToken is nil.
 type LS1EncryptionResponsePacket struct {
 	EncryptedSharedSecret []byte
 	EncryptedVerifyToken []byte
+	Salt int64
+	Signature []byte
 }
 
 func (packet *LS1EncryptionResponsePacket) ID() (id PacketID) {
 	return PacketID{Login, Serverbound, 0x1}
 }
 
-func (packet *LS1EncryptionResponsePacket) Read(r BinaryReader) {
-	sharedSecretLength, _          := r.ReadUint16()
-	packet.EncryptedSharedSecret, _ = r.ReadBytes(int(sharedSecretLength))
-	verifyTokenLength, _           := r.ReadUint16()
-	packet.EncryptedVerifyToken, _  = r.ReadBytes(int(verifyTokenLength))
+func (packet *LS1EncryptionResponsePacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Serverbound, 0x1, 0, version)
+}
+
+func (packet *LS1EncryptionResponsePacket) Read(r BinaryReader) (err error) {
+	version := r.ProtocolVersion()
+	
+	packet.EncryptedSharedSecret, err = readLoginBytes(r)
+	if err != nil {
+		return FieldError("EncryptedSharedSecret", err)
+	}
+	
+	packet.EncryptedVerifyToken, packet.Salt, packet.Signature = nil, 0, nil
+	
+	if version >= loginSigningVersion && version < loginUnsignedVersion {
+		hasVerifyToken, err := r.ReadBool()
+		if err != nil {
+			return FieldError("EncryptedVerifyToken", err)
+		}
+		
+		if !hasVerifyToken {
+			packet.Salt, err = r.ReadInt64()
+			if err != nil {
+				return FieldError("Salt", err)
+			}
+			
+			packet.Signature, err = r.ReadByteArray(MaxPacketLength)
+			if err != nil {
+				return FieldError("Signature", err)
+			}
+			
+			return nil
+		}
+	}
+	
+	packet.EncryptedVerifyToken, err = readLoginBytes(r)
+	if err != nil {
+		return FieldError("EncryptedVerifyToken", err)
+	}
+	
+	return nil
+}
+
+func (packet *LS1EncryptionResponsePacket) Write(w BinaryWriter) (err error) {
+	version := w.ProtocolVersion()
+	
+	err = writeLoginBytes(w, packet.EncryptedSharedSecret)
+	if err != nil {
+		return err
+	}
+	
+	if version >= loginSigningVersion && version < loginUnsignedVersion {
+		hasVerifyToken := packet.EncryptedVerifyToken != nil || packet.Signature == nil
+		err = w.WriteBool(hasVerifyToken)
+		if err != nil {
+			return err
+		}
+		
+		if !hasVerifyToken {
+			err = w.WriteInt64(packet.Salt)
+			if err != nil {
+				return err
+			}
+			
+			return w.WriteByteArray(packet.Signature)
+		}
+	}
+	
+	return writeLoginBytes(w, packet.EncryptedVerifyToken)
+}
+
+type LS2LoginPluginResponsePacket struct {
+	MessageID uint64
+	Successful bool
+	Data []byte
+}
+
+func (packet *LS2LoginPluginResponsePacket) ID() (id PacketID) {
+	return PacketID{Login, Serverbound, 0x2}
+}
+
+func (packet *LS2LoginPluginResponsePacket) VersionID(version uint64) (id PacketID, ok bool) {
+	return loginID(Serverbound, 0x2, loginPluginVersion, version)
+}
+
+func (packet *LS2LoginPluginResponsePacket) Read(r BinaryReader) (err error) {
+	packet.MessageID, err = r.ReadVarint()
+	if err != nil {
+		return FieldError("MessageID", err)
+	}
+	
+	successful, err := r.ReadUint8()
+	if err != nil {
+		return FieldError("Successful", err)
+	}
+	packet.Successful = successful != 0
+	
+	packet.Data, err = r.ReadRemaining()
+	if err != nil {
+		return FieldError("Data", err)
+	}
+	
+	return nil
+}
+
+func (packet *LS2LoginPluginResponsePacket) Write(w BinaryWriter) (err error) {
+	err = w.WriteVarint(packet.MessageID)
+	if err != nil {
+		return err
+	}
+	
+	if packet.Successful {
+		err = w.WriteUint8(1)
+	} else {
+		err = w.WriteUint8(0)
+	}
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(packet.Data)
+}
+
+type SC0StatusResponsePacket struct {
+	JsonData string
+}
+
+func (packet *SC0StatusResponsePacket) ID() (id PacketID) {
+	return PacketID{Status, Clientbound, 0x0}
+}
+
+func (packet *SC0StatusResponsePacket) Read(r BinaryReader) (err error) {
+	packet.JsonData, err = r.ReadString()
+	if err != nil {
+		return FieldError("JsonData", err)
+	}
+	
+	return nil
+}
+
+func (packet *SC0StatusResponsePacket) Write(w BinaryWriter) (err error) {
+	return w.WriteString(packet.JsonData)
+}
+
+type SC1StatusPongPacket struct {
+	Payload int64
+}
+
+func (packet *SC1StatusPongPacket) ID() (id PacketID) {
+	return PacketID{Status, Clientbound, 0x1}
+}
+
+func (packet *SC1StatusPongPacket) Read(r BinaryReader) (err error) {
+	packet.Payload, err = r.ReadInt64()
+	if err != nil {
+		return FieldError("Payload", err)
+	}
+	
+	return nil
+}
+
+func (packet *SC1StatusPongPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteInt64(packet.Payload)
+}
+
+type SS0StatusRequestPacket struct {
+}
+
+func (packet *SS0StatusRequestPacket) ID() (id PacketID) {
+	return PacketID{Status, Serverbound, 0x0}
+}
+
+func (packet *SS0StatusRequestPacket) Read(r BinaryReader) (err error) {
+	return nil
+}
+
+func (packet *SS0StatusRequestPacket) Write(w BinaryWriter) (err error) {
+	return nil
+}
+
+type SS1StatusPingPacket struct {
+	Payload int64
+}
+
+func (packet *SS1StatusPingPacket) ID() (id PacketID) {
+	return PacketID{Status, Serverbound, 0x1}
+}
+
+func (packet *SS1StatusPingPacket) Read(r BinaryReader) (err error) {
+	packet.Payload, err = r.ReadInt64()
+	if err != nil {
+		return FieldError("Payload", err)
+	}
+	
+	return nil
 }
 
-func (packet *LS1EncryptionResponsePacket) Write(w BinaryWriter) {
-	w.WriteUint16(uint16(len(packet.EncryptedSharedSecret)))
-	w.WriteBytes(packet.EncryptedSharedSecret)
-	w.WriteUint16(uint16(len(packet.EncryptedVerifyToken)))
-	w.WriteBytes(packet.EncryptedVerifyToken)
+func (packet *SS1StatusPingPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteInt64(packet.Payload)
 }
@@ -0,0 +1,102 @@
+// Package packets is a catalogue of typed Minecraft packets for use in proxy
+// handlers.
+//
+// Packet numbers and layouts change between Minecraft releases, so each type
+// here describes one logical packet across every protocol version it exists
+// in. The proxy picks the number and layout matching the session's
+// ProtocolVersion, so a handler for *packets.ClientboundChatMessage sees chat
+// messages whether the player is using 1.8 or 1.20.
+//
+// The catalogue covers the packets in the Status state, which are the same in
+// every protocol version, and a handful of commonly intercepted Play packets
+// (keep alives, chat messages and commands, titles, plugin messages, the player
+// list header, Join Game, Respawn and Disconnect) in the protocol versions
+// listed in SupportedVersions. 1.20.2 and later, with their Configuration
+// state, are not supported. Packets that don't exist in a version (or that are
+// not catalogued for it) are passed through untouched.
+//
+// Follow-up: the catalogue was meant to cover every Handshaking, Status, Login
+// and Play packet, and does not yet. Still missing are:
+//
+//   - Typed Handshaking and Login packets. The proxy handles these states
+//     itself and never passes their packets to handlers, so until then use
+//     the proxy package's own types (proxy.HS0HandshakePacket,
+//     proxy.LS0LoginStartPacket and so on), which already pick their numbers
+//     and layouts from the protocol version.
+//   - The remaining Play packets. Their numbers need adding to the proxy's
+//     table (see proxy.PlayNumbers) and their layouts to schema.json or, for
+//     layouts packetgen can't describe, to play.go. Until then they can be
+//     handled as raw packets.
+//
+// Packets with simple layouts are generated from schema.json by packetgen; the
+// rest are written by hand.
+package packets
+
+//go:generate go run ../packetgen/packetgen.go -o generated.go -test roundtrip_test.go schema.json
+
+import (
+	"github.com/kierdavis/proxy"
+)
+
+// Supported protocol versions.
+const (
+	V1_7_2 uint64 = 4
+	V1_7_10 uint64 = 5
+	V1_8 uint64 = 47
+	V1_12_2 uint64 = 340
+	V1_16_5 uint64 = 754
+	V1_20_1 uint64 = 763
+	
+	// The newest supported version, whose packet numbers are returned by the
+	// ID methods.
+	Latest = V1_20_1
+)
+
+var SupportedVersions = []uint64{V1_7_2, V1_7_10, V1_8, V1_12_2, V1_16_5, V1_20_1}
+
+// Supported returns true if the protocol version is one of
+// SupportedVersions.
+func Supported(version uint64) bool {
+	for _, v := range SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// layout returns the version whose packet layouts are used for the given
+// version. 1.7.2 and 1.7.10 share their layouts.
+func layout(version uint64) uint64 {
+	if version == V1_7_2 {
+		return V1_7_10
+	}
+	return version
+}
+
+// numbers maps (layout) protocol versions to a packet's number.
+type numbers map[uint64]uint64
+
+func (n numbers) id(state proxy.State, dir proxy.Direction, version uint64) (id proxy.PacketID, ok bool) {
+	number, ok := n[layout(version)]
+	return proxy.PacketID{State: state, Direction: dir, Number: number}, ok
+}
+
+// latestID returns the packet's ID in the newest version it exists in.
+func (n numbers) latestID(state proxy.State, dir proxy.Direction) (id proxy.PacketID) {
+	latest := uint64(0)
+	for v := range n {
+		if v > latest {
+			latest = v
+		}
+	}
+	
+	id, _ = n.id(state, dir, latest)
+	return id
+}
+
+// playNumbers returns the numbers of a Play packet from the proxy's table, which
+// is shared with the proxy's own packets.
+func playNumbers(name string) (n numbers) {
+	return numbers(proxy.PlayNumbers(name))
+}
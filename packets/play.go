@@ -0,0 +1,696 @@
+package packets
+
+import (
+	"fmt"
+	
+	"github.com/kierdavis/proxy"
+)
+
+// KeepAlive IDs are an int32 in 1.7, a varint in 1.8 and an int64 from 1.12.2
+// onwards.
+type ClientboundKeepAlive struct {
+	KeepAliveID int64
+}
+
+var clientboundKeepAliveNumbers = playNumbers("ClientboundKeepAlive")
+
+func (packet *ClientboundKeepAlive) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(Latest)
+	return id
+}
+
+func (packet *ClientboundKeepAlive) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return clientboundKeepAliveNumbers.id(proxy.Play, proxy.Clientbound, version)
+}
+
+func (packet *ClientboundKeepAlive) Read(r proxy.BinaryReader) (err error) {
+	packet.KeepAliveID, err = readKeepAliveID(r)
+	if err != nil {
+		return proxy.FieldError("KeepAliveID", err)
+	}
+	
+	return nil
+}
+
+func (packet *ClientboundKeepAlive) Write(w proxy.BinaryWriter) (err error) {
+	return writeKeepAliveID(w, packet.KeepAliveID)
+}
+
+type ServerboundKeepAlive struct {
+	KeepAliveID int64
+}
+
+var serverboundKeepAliveNumbers = playNumbers("ServerboundKeepAlive")
+
+func (packet *ServerboundKeepAlive) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(Latest)
+	return id
+}
+
+func (packet *ServerboundKeepAlive) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return serverboundKeepAliveNumbers.id(proxy.Play, proxy.Serverbound, version)
+}
+
+func (packet *ServerboundKeepAlive) Read(r proxy.BinaryReader) (err error) {
+	packet.KeepAliveID, err = readKeepAliveID(r)
+	if err != nil {
+		return proxy.FieldError("KeepAliveID", err)
+	}
+	
+	return nil
+}
+
+func (packet *ServerboundKeepAlive) Write(w proxy.BinaryWriter) (err error) {
+	return writeKeepAliveID(w, packet.KeepAliveID)
+}
+
+func readKeepAliveID(r proxy.BinaryReader) (x int64, err error) {
+	switch {
+	case r.ProtocolVersion() >= V1_12_2:
+		return r.ReadInt64()
+	
+	case r.ProtocolVersion() >= V1_8:
+		v, err := r.ReadVarint()
+		return int64(int32(v)), err
+	}
+	
+	v, err := r.ReadInt32()
+	return int64(v), err
+}
+
+func writeKeepAliveID(w proxy.BinaryWriter, x int64) (err error) {
+	switch {
+	case w.ProtocolVersion() >= V1_12_2:
+		return w.WriteInt64(x)
+	
+	case w.ProtocolVersion() >= V1_8:
+		return w.WriteVarint(uint64(uint32(x)))
+	}
+	
+	return w.WriteInt32(int32(x))
+}
+
+// Chat message positions.
+const (
+	ChatPositionChat uint8 = 0
+	ChatPositionSystem uint8 = 1
+	ChatPositionActionBar uint8 = 2
+)
+
+// ClientboundChatMessage is the Chat Message packet up to 1.16.5 and the
+// System Chat Message packet in 1.20.1. Position is not sent in 1.7, and in
+// 1.20.1 only the distinction between ChatPositionActionBar and the others is
+// kept. Sender is only sent in 1.16.5.
+type ClientboundChatMessage struct {
+	JsonData string
+	Position uint8
+	Sender string
+}
+
+var clientboundChatMessageNumbers = playNumbers("ClientboundChatMessage")
+
+func (packet *ClientboundChatMessage) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(Latest)
+	return id
+}
+
+func (packet *ClientboundChatMessage) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return clientboundChatMessageNumbers.id(proxy.Play, proxy.Clientbound, version)
+}
+
+func (packet *ClientboundChatMessage) Read(r proxy.BinaryReader) (err error) {
+	packet.JsonData, err = r.ReadString()
+	if err != nil {
+		return proxy.FieldError("JsonData", err)
+	}
+	
+	packet.Position, packet.Sender = ChatPositionChat, ""
+	
+	switch {
+	case r.ProtocolVersion() >= V1_20_1:
+		overlay, err := r.ReadBool()
+		if err != nil {
+			return proxy.FieldError("Position", err)
+		}
+		
+		packet.Position = ChatPositionSystem
+		if overlay {
+			packet.Position = ChatPositionActionBar
+		}
+	
+	case r.ProtocolVersion() >= V1_8:
+		packet.Position, err = r.ReadUint8()
+		if err != nil {
+			return proxy.FieldError("Position", err)
+		}
+		
+		if r.ProtocolVersion() >= V1_16_5 {
+			packet.Sender, err = readBinaryUUID(r)
+			if err != nil {
+				return proxy.FieldError("Sender", err)
+			}
+		}
+	}
+	
+	return nil
+}
+
+func (packet *ClientboundChatMessage) Write(w proxy.BinaryWriter) (err error) {
+	err = w.WriteString(packet.JsonData)
+	if err != nil {
+		return err
+	}
+	
+	switch {
+	case w.ProtocolVersion() >= V1_20_1:
+		return w.WriteBool(packet.Position == ChatPositionActionBar)
+	
+	case w.ProtocolVersion() >= V1_16_5:
+		err = w.WriteUint8(packet.Position)
+		if err != nil {
+			return err
+		}
+		
+		sender := packet.Sender
+		if sender == "" {
+			sender = "00000000-0000-0000-0000-000000000000"
+		}
+		
+		return writeBinaryUUID(w, sender)
+	
+	case w.ProtocolVersion() >= V1_8:
+		return w.WriteUint8(packet.Position)
+	}
+	
+	return nil
+}
+
+// ServerboundChatMessage is limited to 100 characters up to 1.8 and 256 from
+// 1.12.2 onwards. The signing fields are only sent in 1.20.1.
+type ServerboundChatMessage struct {
+	Message string
+	Timestamp int64
+	Salt int64
+	Signature []byte
+	MessageCount uint64
+	Acknowledged [3]byte
+}
+
+var serverboundChatMessageNumbers = playNumbers("ServerboundChatMessage")
+
+func (packet *ServerboundChatMessage) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(Latest)
+	return id
+}
+
+func (packet *ServerboundChatMessage) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return serverboundChatMessageNumbers.id(proxy.Play, proxy.Serverbound, version)
+}
+
+func chatMessageMax(version uint64) int {
+	if version >= V1_12_2 {
+		return 256
+	}
+	return 100
+}
+
+func (packet *ServerboundChatMessage) Read(r proxy.BinaryReader) (err error) {
+	packet.Message, err = r.ReadStringMax(chatMessageMax(r.ProtocolVersion()))
+	if err != nil {
+		return proxy.FieldError("Message", err)
+	}
+	
+	if r.ProtocolVersion() < V1_20_1 {
+		return nil
+	}
+	
+	packet.Timestamp, err = r.ReadInt64()
+	if err != nil {
+		return proxy.FieldError("Timestamp", err)
+	}
+	
+	packet.Salt, err = r.ReadInt64()
+	if err != nil {
+		return proxy.FieldError("Salt", err)
+	}
+	
+	hasSignature, err := r.ReadBool()
+	if err != nil {
+		return proxy.FieldError("Signature", err)
+	}
+	
+	packet.Signature = nil
+	if hasSignature {
+		packet.Signature, err = r.ReadBytes(256)
+		if err != nil {
+			return proxy.FieldError("Signature", err)
+		}
+	}
+	
+	packet.MessageCount, err = r.ReadVarint()
+	if err != nil {
+		return proxy.FieldError("MessageCount", err)
+	}
+	
+	acknowledged, err := r.ReadBytes(3)
+	if err != nil {
+		return proxy.FieldError("Acknowledged", err)
+	}
+	copy(packet.Acknowledged[:], acknowledged)
+	
+	return nil
+}
+
+func (packet *ServerboundChatMessage) Write(w proxy.BinaryWriter) (err error) {
+	err = w.WriteString(packet.Message)
+	if err != nil {
+		return err
+	}
+	
+	if w.ProtocolVersion() < V1_20_1 {
+		return nil
+	}
+	
+	err = w.WriteInt64(packet.Timestamp)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteInt64(packet.Salt)
+	if err != nil {
+		return err
+	}
+	
+	err = writeSignature(w, packet.Signature)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteVarint(packet.MessageCount)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(packet.Acknowledged[:])
+}
+
+func writeSignature(w proxy.BinaryWriter, signature []byte) (err error) {
+	if signature == nil {
+		return w.WriteBool(false)
+	}
+	
+	if len(signature) != 256 {
+		return fmt.Errorf("Invalid signature length %d", len(signature))
+	}
+	
+	err = w.WriteBool(true)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(signature)
+}
+
+// ArgumentSignature is a signed command argument in ChatCommand.
+type ArgumentSignature struct {
+	Name string
+	Signature []byte
+}
+
+// ChatCommand is sent instead of ServerboundChatMessage for commands in
+// 1.20.1. Command does not include the leading slash.
+type ChatCommand struct {
+	Command string
+	Timestamp int64
+	Salt int64
+	ArgumentSignatures []ArgumentSignature
+	MessageCount uint64
+	Acknowledged [3]byte
+}
+
+var chatCommandNumbers = playNumbers("ChatCommand")
+
+func (packet *ChatCommand) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(Latest)
+	return id
+}
+
+func (packet *ChatCommand) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return chatCommandNumbers.id(proxy.Play, proxy.Serverbound, version)
+}
+
+func (packet *ChatCommand) Read(r proxy.BinaryReader) (err error) {
+	packet.Command, err = r.ReadStringMax(256)
+	if err != nil {
+		return proxy.FieldError("Command", err)
+	}
+	
+	packet.Timestamp, err = r.ReadInt64()
+	if err != nil {
+		return proxy.FieldError("Timestamp", err)
+	}
+	
+	packet.Salt, err = r.ReadInt64()
+	if err != nil {
+		return proxy.FieldError("Salt", err)
+	}
+	
+	count, err := r.ReadVarint()
+	if err != nil {
+		return proxy.FieldError("ArgumentSignatures", err)
+	}
+	
+	if count > 8 {
+		return proxy.FieldError("ArgumentSignatures", fmt.Errorf("Too many argument signatures (%d)", count))
+	}
+	
+	packet.ArgumentSignatures = nil
+	for i := uint64(0); i < count; i++ {
+		var sig ArgumentSignature
+		
+		sig.Name, err = r.ReadStringMax(16)
+		if err != nil {
+			return proxy.FieldError("ArgumentSignatures", err)
+		}
+		
+		sig.Signature, err = r.ReadBytes(256)
+		if err != nil {
+			return proxy.FieldError("ArgumentSignatures", err)
+		}
+		
+		packet.ArgumentSignatures = append(packet.ArgumentSignatures, sig)
+	}
+	
+	packet.MessageCount, err = r.ReadVarint()
+	if err != nil {
+		return proxy.FieldError("MessageCount", err)
+	}
+	
+	acknowledged, err := r.ReadBytes(3)
+	if err != nil {
+		return proxy.FieldError("Acknowledged", err)
+	}
+	copy(packet.Acknowledged[:], acknowledged)
+	
+	return nil
+}
+
+func (packet *ChatCommand) Write(w proxy.BinaryWriter) (err error) {
+	err = w.WriteString(packet.Command)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteInt64(packet.Timestamp)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteInt64(packet.Salt)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteVarint(uint64(len(packet.ArgumentSignatures)))
+	if err != nil {
+		return err
+	}
+	
+	for _, sig := range packet.ArgumentSignatures {
+		if len(sig.Signature) != 256 {
+			return fmt.Errorf("Invalid signature length %d", len(sig.Signature))
+		}
+		
+		err = w.WriteString(sig.Name)
+		if err != nil {
+			return err
+		}
+		
+		err = w.WriteBytes(sig.Signature)
+		if err != nil {
+			return err
+		}
+	}
+	
+	err = w.WriteVarint(packet.MessageCount)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(packet.Acknowledged[:])
+}
+
+type TitleAction int
+
+// Title actions. The numbering used on the wire differs between versions.
+const (
+	TitleSetTitle TitleAction = iota
+	TitleSetSubtitle
+	TitleSetActionBar
+	TitleSetTimes
+	TitleHide
+	TitleReset
+)
+
+// Wire numbering of title actions in 1.8, which has no action bar.
+var titleActions18 = []TitleAction{TitleSetTitle, TitleSetSubtitle, TitleSetTimes, TitleHide, TitleReset}
+
+// Title exists from 1.8 to 1.16.5; 1.17 split it into SetTitleText,
+// SetSubtitleText, SetActionBarText, SetTitleTimes and ClearTitles.
+// TitleSetActionBar is only available from 1.11 onwards. Text is used by the
+// title, subtitle and action bar actions and the timings by TitleSetTimes.
+type Title struct {
+	Action TitleAction
+	Text string
+	FadeIn int32
+	Stay int32
+	FadeOut int32
+}
+
+var titleNumbers = playNumbers("Title")
+
+func (packet *Title) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(V1_16_5)
+	return id
+}
+
+func (packet *Title) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return titleNumbers.id(proxy.Play, proxy.Clientbound, version)
+}
+
+func (packet *Title) Read(r proxy.BinaryReader) (err error) {
+	n, err := r.ReadVarint()
+	if err != nil {
+		return proxy.FieldError("Action", err)
+	}
+	
+	if r.ProtocolVersion() >= V1_12_2 {
+		if n > uint64(TitleReset) {
+			return proxy.FieldError("Action", fmt.Errorf("Invalid title action %d", n))
+		}
+		packet.Action = TitleAction(n)
+		
+	} else {
+		if n >= uint64(len(titleActions18)) {
+			return proxy.FieldError("Action", fmt.Errorf("Invalid title action %d", n))
+		}
+		packet.Action = titleActions18[n]
+	}
+	
+	switch packet.Action {
+	case TitleSetTitle, TitleSetSubtitle, TitleSetActionBar:
+		packet.Text, err = r.ReadString()
+		if err != nil {
+			return proxy.FieldError("Text", err)
+		}
+	
+	case TitleSetTimes:
+		packet.FadeIn, packet.Stay, packet.FadeOut, err = readTitleTimes(r)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+func (packet *Title) Write(w proxy.BinaryWriter) (err error) {
+	n := -1
+	
+	if w.ProtocolVersion() >= V1_12_2 {
+		n = int(packet.Action)
+		
+	} else {
+		for i, action := range titleActions18 {
+			if action == packet.Action {
+				n = i
+			}
+		}
+	}
+	
+	if n < 0 || n > int(TitleReset) {
+		return fmt.Errorf("Title action %d is not supported in protocol version %d", packet.Action, w.ProtocolVersion())
+	}
+	
+	err = w.WriteVarint(uint64(n))
+	if err != nil {
+		return err
+	}
+	
+	switch packet.Action {
+	case TitleSetTitle, TitleSetSubtitle, TitleSetActionBar:
+		return w.WriteString(packet.Text)
+	
+	case TitleSetTimes:
+		return writeTitleTimes(w, packet.FadeIn, packet.Stay, packet.FadeOut)
+	}
+	
+	return nil
+}
+
+func readTitleTimes(r proxy.BinaryReader) (fadeIn int32, stay int32, fadeOut int32, err error) {
+	fadeIn, err = r.ReadInt32()
+	if err != nil {
+		return 0, 0, 0, proxy.FieldError("FadeIn", err)
+	}
+	
+	stay, err = r.ReadInt32()
+	if err != nil {
+		return 0, 0, 0, proxy.FieldError("Stay", err)
+	}
+	
+	fadeOut, err = r.ReadInt32()
+	if err != nil {
+		return 0, 0, 0, proxy.FieldError("FadeOut", err)
+	}
+	
+	return fadeIn, stay, fadeOut, nil
+}
+
+func writeTitleTimes(w proxy.BinaryWriter, fadeIn int32, stay int32, fadeOut int32) (err error) {
+	err = w.WriteInt32(fadeIn)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteInt32(stay)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteInt32(fadeOut)
+}
+
+// JoinGame is only catalogued up to 1.12.2; its layout in later versions
+// carries registry data that this package doesn't decode. Dimension is sent as
+// an int8 before 1.9 and ReducedDebugInfo from 1.8 onwards.
+type JoinGame struct {
+	EntityID int32
+	Gamemode uint8
+	Dimension int32
+	Difficulty uint8
+	MaxPlayers uint8
+	LevelType string
+	ReducedDebugInfo bool
+}
+
+var joinGameNumbers = playNumbers("JoinGame")
+
+func (packet *JoinGame) ID() (id proxy.PacketID) {
+	id, _ = packet.VersionID(V1_12_2)
+	return id
+}
+
+func (packet *JoinGame) VersionID(version uint64) (id proxy.PacketID, ok bool) {
+	return joinGameNumbers.id(proxy.Play, proxy.Clientbound, version)
+}
+
+func (packet *JoinGame) Read(r proxy.BinaryReader) (err error) {
+	packet.EntityID, err = r.ReadInt32()
+	if err != nil {
+		return proxy.FieldError("EntityID", err)
+	}
+	
+	packet.Gamemode, err = r.ReadUint8()
+	if err != nil {
+		return proxy.FieldError("Gamemode", err)
+	}
+	
+	if r.ProtocolVersion() >= V1_12_2 {
+		packet.Dimension, err = r.ReadInt32()
+	} else {
+		var dimension int8
+		dimension, err = r.ReadInt8()
+		packet.Dimension = int32(dimension)
+	}
+	if err != nil {
+		return proxy.FieldError("Dimension", err)
+	}
+	
+	packet.Difficulty, err = r.ReadUint8()
+	if err != nil {
+		return proxy.FieldError("Difficulty", err)
+	}
+	
+	packet.MaxPlayers, err = r.ReadUint8()
+	if err != nil {
+		return proxy.FieldError("MaxPlayers", err)
+	}
+	
+	packet.LevelType, err = r.ReadStringMax(16)
+	if err != nil {
+		return proxy.FieldError("LevelType", err)
+	}
+	
+	packet.ReducedDebugInfo = false
+	if r.ProtocolVersion() >= V1_8 {
+		packet.ReducedDebugInfo, err = r.ReadBool()
+		if err != nil {
+			return proxy.FieldError("ReducedDebugInfo", err)
+		}
+	}
+	
+	return nil
+}
+
+func (packet *JoinGame) Write(w proxy.BinaryWriter) (err error) {
+	err = w.WriteInt32(packet.EntityID)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Gamemode)
+	if err != nil {
+		return err
+	}
+	
+	if w.ProtocolVersion() >= V1_12_2 {
+		err = w.WriteInt32(packet.Dimension)
+	} else {
+		err = w.WriteInt8(int8(packet.Dimension))
+	}
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.Difficulty)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteUint8(packet.MaxPlayers)
+	if err != nil {
+		return err
+	}
+	
+	err = w.WriteString(packet.LevelType)
+	if err != nil {
+		return err
+	}
+	
+	if w.ProtocolVersion() >= V1_8 {
+		return w.WriteBool(packet.ReducedDebugInfo)
+	}
+	
+	return nil
+}
\ No newline at end of file
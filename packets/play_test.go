@@ -0,0 +1,219 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	
+	"github.com/kierdavis/proxy"
+)
+
+// playTest describes a hand-written packet that should be written as data, and
+// read back from it again, in a protocol version.
+type playTest struct {
+	name string
+	version uint64
+	data string
+	packet proxy.Packet
+}
+
+func runPlayTests(t *testing.T, tests []playTest) {
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+		
+		err := test.packet.Write(proxy.NewVersionedBinaryWriter(buf, test.version))
+		if err != nil {
+			t.Errorf("%s: write failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if hex.EncodeToString(buf.Bytes()) != test.data {
+			t.Errorf("%s: wrote %x, expected %s", test.name, buf.Bytes(), test.data)
+			continue
+		}
+		
+		packet := reflect.New(reflect.TypeOf(test.packet).Elem()).Interface().(proxy.Packet)
+		
+		err = packet.Read(proxy.NewVersionedBinaryReader(buf, test.version))
+		if err != nil {
+			t.Errorf("%s: read failed: %s", test.name, err.Error())
+			continue
+		}
+		
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left unread", test.name, buf.Len())
+		}
+		
+		if !reflect.DeepEqual(packet, test.packet) {
+			t.Errorf("%s: read %+v, expected %+v", test.name, packet, test.packet)
+		}
+	}
+}
+
+// The string "hi" as chat JSON, prefixed with its length.
+const hiJSON = "0422686922"
+
+func TestKeepAliveRoundTrip(t *testing.T) {
+	var tests []playTest
+	
+	for _, test := range []struct {
+		name string
+		version uint64
+		data string
+		id int64
+	}{
+		{"1.7 int32", V1_7_10, "0012d687", 1234567},
+		{"1.7 negative int32", V1_7_10, "fffffffb", -5},
+		{"1.8 varint", V1_8, "ac02", 300},
+		{"1.8 negative varint", V1_8, "ffffffff0f", -1},
+		{"1.12.2 int64", V1_12_2, "0000011f71fb04cb", 1234567890123},
+		{"1.16.5 int64", V1_16_5, "0000011f71fb04cb", 1234567890123},
+		{"1.20.1 int64", V1_20_1, "fffffffffffffffe", -2},
+	} {
+		tests = append(tests,
+			playTest{"ClientboundKeepAlive " + test.name, test.version, test.data, &ClientboundKeepAlive{test.id}},
+			playTest{"ServerboundKeepAlive " + test.name, test.version, test.data, &ServerboundKeepAlive{test.id}},
+		)
+	}
+	
+	runPlayTests(t, tests)
+}
+
+func TestClientboundChatMessageRoundTrip(t *testing.T) {
+	const sender = "01234567-89ab-cdef-0123-456789abcdef"
+	
+	runPlayTests(t, []playTest{
+		{"1.7.2", V1_7_2, hiJSON, &ClientboundChatMessage{JsonData: `"hi"`}},
+		{"1.7.10", V1_7_10, hiJSON, &ClientboundChatMessage{JsonData: `"hi"`}},
+		{"1.8 system", V1_8, hiJSON + "01", &ClientboundChatMessage{JsonData: `"hi"`, Position: ChatPositionSystem}},
+		{"1.12.2 action bar", V1_12_2, hiJSON + "02", &ClientboundChatMessage{JsonData: `"hi"`, Position: ChatPositionActionBar}},
+		{"1.16.5 sender", V1_16_5, hiJSON + "00" + "0123456789abcdef0123456789abcdef", &ClientboundChatMessage{JsonData: `"hi"`, Position: ChatPositionChat, Sender: sender}},
+		{"1.20.1 system", V1_20_1, hiJSON + "00", &ClientboundChatMessage{JsonData: `"hi"`, Position: ChatPositionSystem}},
+		{"1.20.1 action bar", V1_20_1, hiJSON + "01", &ClientboundChatMessage{JsonData: `"hi"`, Position: ChatPositionActionBar}},
+	})
+}
+
+func TestServerboundChatMessageRoundTrip(t *testing.T) {
+	const hello = "0568656c6c6f"
+	const signed = "0000000000000001" + "0000000000000002"
+	
+	runPlayTests(t, []playTest{
+		{"1.7.10", V1_7_10, hello, &ServerboundChatMessage{Message: "hello"}},
+		{"1.8", V1_8, hello, &ServerboundChatMessage{Message: "hello"}},
+		{"1.12.2", V1_12_2, hello, &ServerboundChatMessage{Message: "hello"}},
+		{"1.16.5", V1_16_5, hello, &ServerboundChatMessage{Message: "hello"}},
+		{"1.20.1 unsigned", V1_20_1, hello + signed + "00" + "03" + "010204", &ServerboundChatMessage{
+			Message: "hello",
+			Timestamp: 1,
+			Salt: 2,
+			MessageCount: 3,
+			Acknowledged: [3]byte{1, 2, 4},
+		}},
+		{"1.20.1 signed", V1_20_1, hello + signed + "01" + strings.Repeat("ab", 256) + "00" + "000000", &ServerboundChatMessage{
+			Message: "hello",
+			Timestamp: 1,
+			Salt: 2,
+			Signature: bytes.Repeat([]byte{0xab}, 256),
+		}},
+	})
+}
+
+func TestChatCommandRoundTrip(t *testing.T) {
+	const help = "0468656c70" + "0000000000000001" + "0000000000000002"
+	
+	runPlayTests(t, []playTest{
+		{"no arguments", V1_20_1, help + "00" + "05" + "ffffff", &ChatCommand{
+			Command: "help",
+			Timestamp: 1,
+			Salt: 2,
+			MessageCount: 5,
+			Acknowledged: [3]byte{0xff, 0xff, 0xff},
+		}},
+		{"signed argument", V1_20_1, help + "01" + "036d7367" + strings.Repeat("cd", 256) + "00" + "000000", &ChatCommand{
+			Command: "help",
+			Timestamp: 1,
+			Salt: 2,
+			ArgumentSignatures: []ArgumentSignature{{"msg", bytes.Repeat([]byte{0xcd}, 256)}},
+		}},
+	})
+}
+
+func TestTitleRoundTrip(t *testing.T) {
+	const times = "0000000a" + "00000046" + "00000014"
+	
+	runPlayTests(t, []playTest{
+		{"1.8 title", V1_8, "00" + hiJSON, &Title{Action: TitleSetTitle, Text: `"hi"`}},
+		{"1.8 subtitle", V1_8, "01" + hiJSON, &Title{Action: TitleSetSubtitle, Text: `"hi"`}},
+		{"1.8 times", V1_8, "02" + times, &Title{Action: TitleSetTimes, FadeIn: 10, Stay: 70, FadeOut: 20}},
+		{"1.8 hide", V1_8, "03", &Title{Action: TitleHide}},
+		{"1.8 reset", V1_8, "04", &Title{Action: TitleReset}},
+		{"1.12.2 action bar", V1_12_2, "02" + hiJSON, &Title{Action: TitleSetActionBar, Text: `"hi"`}},
+		{"1.12.2 times", V1_12_2, "03" + times, &Title{Action: TitleSetTimes, FadeIn: 10, Stay: 70, FadeOut: 20}},
+		{"1.16.5 subtitle", V1_16_5, "01" + hiJSON, &Title{Action: TitleSetSubtitle, Text: `"hi"`}},
+		{"1.16.5 hide", V1_16_5, "04", &Title{Action: TitleHide}},
+		{"1.16.5 reset", V1_16_5, "05", &Title{Action: TitleReset}},
+	})
+}
+
+func TestJoinGameRoundTrip(t *testing.T) {
+	const start = "00000001" + "01"
+	const rest = "02" + "14" + "0764656661756c74"
+	
+	runPlayTests(t, []playTest{
+		{"1.7.10", V1_7_10, start + "ff" + rest, &JoinGame{EntityID: 1, Gamemode: 1, Dimension: -1, Difficulty: 2, MaxPlayers: 20, LevelType: "default"}},
+		{"1.8", V1_8, start + "ff" + rest + "01", &JoinGame{EntityID: 1, Gamemode: 1, Dimension: -1, Difficulty: 2, MaxPlayers: 20, LevelType: "default", ReducedDebugInfo: true}},
+		{"1.12.2", V1_12_2, start + "ffffffff" + rest + "00", &JoinGame{EntityID: 1, Gamemode: 1, Dimension: -1, Difficulty: 2, MaxPlayers: 20, LevelType: "default"}},
+	})
+}
+
+func TestPlayReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		version uint64
+		data string
+		packet proxy.Packet
+	}{
+		{"1.8 chat message longer than 100", V1_8, "65" + strings.Repeat("61", 101), &ServerboundChatMessage{}},
+		{"1.12.2 chat message longer than 256", V1_12_2, "8102" + strings.Repeat("61", 257), &ServerboundChatMessage{}},
+		{"truncated signature", V1_20_1, "0568656c6c6f" + strings.Repeat("00", 16) + "01abab", &ServerboundChatMessage{}},
+		{"too many argument signatures", V1_20_1, "0468656c70" + strings.Repeat("00", 16) + "09", &ChatCommand{}},
+		{"1.8 title action", V1_8, "05", &Title{}},
+		{"1.12.2 title action", V1_12_2, "06", &Title{}},
+		{"truncated title times", V1_8, "020000000a", &Title{}},
+		{"truncated join game", V1_8, "00000001", &JoinGame{}},
+		{"truncated keep alive", V1_12_2, "00000001", &ClientboundKeepAlive{}},
+	}
+	
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		err = test.packet.Read(proxy.NewVersionedBinaryReader(bytes.NewReader(data), test.version))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestPlayWriteErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		version uint64
+		packet proxy.Packet
+	}{
+		{"1.8 action bar title", V1_8, &Title{Action: TitleSetActionBar, Text: `"hi"`}},
+		{"short chat signature", V1_20_1, &ServerboundChatMessage{Message: "hello", Signature: []byte{1, 2, 3}}},
+		{"short argument signature", V1_20_1, &ChatCommand{Command: "help", ArgumentSignatures: []ArgumentSignature{{"msg", []byte{1}}}}},
+	}
+	
+	for _, test := range tests {
+		err := test.packet.Write(proxy.NewVersionedBinaryWriter(bytes.NewBuffer(nil), test.version))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package packets
+
+import (
+	"fmt"
+	
+	"github.com/kierdavis/proxy"
+)
+
+// readBinaryUUID reads a UUID sent as 16 bytes and returns it in its
+// hyphenated string form.
+func readBinaryUUID(r proxy.BinaryReader) (uuid string, err error) {
+	u, err := r.ReadUUID()
+	if err != nil {
+		return "", err
+	}
+	
+	return u.String(), nil
+}
+
+// writeBinaryUUID writes a UUID given as a string (with or without hyphens) as
+// 16 bytes.
+func writeBinaryUUID(w proxy.BinaryWriter, uuid string) (err error) {
+	u, err := proxy.ParseUUID(uuid)
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteUUID(u)
+}
+
+// readShortBytes reads a byte array prefixed with its length as a uint16, as
+// used by 1.7.
+func readShortBytes(r proxy.BinaryReader) (buf []byte, err error) {
+	length, err := r.ReadUint16()
+	if err != nil {
+		return nil, err
+	}
+	
+	return r.ReadBytes(int(length))
+}
+
+func writeShortBytes(w proxy.BinaryWriter, buf []byte) (err error) {
+	if len(buf) > 0xffff {
+		return fmt.Errorf("Array length %d exceeds maximum of %d", len(buf), 0xffff)
+	}
+	
+	err = w.WriteUint16(uint16(len(buf)))
+	if err != nil {
+		return err
+	}
+	
+	return w.WriteBytes(buf)
+}
@@ -1,15 +1,89 @@
 package proxy
 
 import (
+	"context"
+	"github.com/kierdavis/proxy/chat"
 	"log"
 	"net"
+	"sync"
+	"time"
 )
 
 type Proxy struct {
 	Errors chan error
+	
+	// Compression threshold announced to clients when the server enables
+	// compression. If negative, the server's own threshold is passed on.
+	ClientCompressionThreshold int
+	
+	// If true, connecting clients must authenticate with the session server
+	// before they are let through to the server.
+	OnlineMode bool
+	
+	// Authentication and session servers used to log in to the server and
+	// to authenticate clients.
+	AuthService AuthService
+	
+	// If not empty, the account's access token is saved to this file so that
+	// it can be reused after a restart.
+	TokenFile string
+	
+	// If not nil, called with the server's response to each server list ping
+	// so that it can be changed before it reaches the client.
+	StatusHandler StatusHandler
+	
+	// If not nil, answers server list pings in place of the servers.
+	StatusProvider *StatusProvider
+	
+	// Status shown in the server list when the server can't be reached and
+	// hasn't answered a ping since the proxy started. If its protocol version
+	// is 0, the client's own version is shown.
+	OfflineStatus *ServerStatus
+	
+	// Disconnect message sent to players who try to log in while the server
+	// can't be reached.
+	OfflineMessage *chat.Component
+	
+	// Disconnect message sent to players who try to log in with a protocol
+	// version the proxy doesn't support (see SupportedVersion).
+	UnsupportedVersionMessage *chat.Component
+	
+	// Disconnect message sent to every connected player when the proxy shuts
+	// down.
+	ShutdownMessage *chat.Component
+	
+	// How often Run pings the servers to check which are up, or 0 (the
+	// default) to not check them. Clients are sent to servers that are down
+	// only if none of the servers for their route are up. Without health
+	// checks, the servers for a route are simply tried in order.
+	HealthCheckInterval time.Duration
+	
+	// How long a health check waits for each server to answer.
+	HealthCheckTimeout time.Duration
+	
+	// How long to wait when connecting to a server, and when logging in to a
+	// server to switch to with Session.Connect, or 0 to wait forever.
+	ConnectTimeout time.Duration
+	
+	// How long Run waits for sessions to end after its context is cancelled
+	// before closing their connections outright.
+	ShutdownTimeout time.Duration
+	
+	lock sync.Mutex
+	sessions map[*Session]struct{}
+	sessionsWG sync.WaitGroup
+	shuttingDown bool
+	
+	// The last status response from each server, shown while it is down.
+	statusCache map[Address]string
+	
+	// The results of the latest health check.
+	health map[Address]ServerHealth
+	
 	listener net.Listener
 	bindAddr Address
-	serverAddr Address
+	router *router
+	registry *Registry
 	hm *handlerManager
 	gem *globalEncryptionManager
 }
@@ -20,68 +94,255 @@ func New(bindAddr, serverAddr Address, username, password string) (proxy *Proxy,
 		return nil, err
 	}
 	
+	rt := newRouter()
+	rt.Add("*", []Address{serverAddr})
+	
+	registry := newCoreRegistry()
+	
 	proxy = &Proxy{
 		Errors: make(chan error, 10),
+		ClientCompressionThreshold: -1,
+		AuthService: NewHTTPAuthService(),
+		OfflineStatus: &ServerStatus{Description: chat.Text("Server offline")},
+		OfflineMessage: chat.Text("The server is offline. Please try again later."),
+		UnsupportedVersionMessage: chat.Text("This version of Minecraft is not supported."),
+		ShutdownMessage: chat.Text("Proxy shutting down"),
+		HealthCheckTimeout: 3 * time.Second,
+		ConnectTimeout: 10 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+		sessions: make(map[*Session]struct{}),
+		statusCache: make(map[Address]string),
 		bindAddr: bindAddr,
-		serverAddr: serverAddr,
-		hm: newHandlerManager(),
+		router: rt,
+		registry: registry,
+		hm: newHandlerManager(registry),
 		gem: gem,
 	}
 	
 	return proxy, nil
 }
 
+// AddHandler adds a packet or event handler. Packet handlers are only called
+// with packets in the Status and Play states; AddHandler panics if given a
+// handler for a packet in another state.
 func (proxy *Proxy) AddHandler(handler interface{}) {
 	proxy.hm.Add(handler)
 }
 
-func (proxy *Proxy) Run() (err error) {
-	go proxy.RunAsync()
-	
-	return <-proxy.Errors
+// Registry returns the registry used to find the packet types for IDs in each
+// protocol version. Packet types with handlers are added to it automatically;
+// Register can be used to give a packet a different ID in some versions.
+func (proxy *Proxy) Registry() (registry *Registry) {
+	return proxy.registry
 }
 
-func (proxy *Proxy) RunAsync() {
-	defer close(proxy.Errors)
-	
+// AddRawHandler adds a handler called with every packet with the given ID,
+// before it is decoded. The ID must be in the Status or Play state, as the
+// Handshaking and Login packets are handled by the proxy itself; AddRawHandler
+// panics otherwise.
+func (proxy *Proxy) AddRawHandler(id PacketID, handler RawHandler) {
+	proxy.hm.AddRaw(id, handler)
+}
+
+// AddRawStateHandler adds a handler called with every packet sent in the given
+// state and direction, before it is decoded. The state must be Status or Play;
+// AddRawStateHandler panics otherwise.
+func (proxy *Proxy) AddRawStateHandler(state State, dir Direction, handler RawHandler) {
+	proxy.hm.AddRawState(state, dir, handler)
+}
+
+// AddRawGlobalHandler adds a handler called with every packet in the Status and
+// Play states, before it is decoded. The Handshaking and Login packets are
+// handled by the proxy itself and are not passed to it.
+func (proxy *Proxy) AddRawGlobalHandler(handler RawHandler) {
+	proxy.hm.AddRawGlobal(handler)
+}
+
+// AddRoute forwards clients that connect using a hostname matching pattern to
+// serverAddr. The pattern may be an exact hostname such as
+// "survival.example.net", a wildcard such as "*.example.net", or "*" to replace
+// the default route (initially the server address passed to New). While
+// serverAddr is down, clients are forwarded to the first of the fallbacks that
+// is up instead.
+func (proxy *Proxy) AddRoute(pattern string, serverAddr Address, fallbacks ...Address) {
+	proxy.router.Add(pattern, append([]Address{serverAddr}, fallbacks...))
+}
+
+// RemoveRoute removes a route previously added with AddRoute. Removing the "*"
+// route makes the proxy refuse clients using unrecognised hostnames.
+func (proxy *Proxy) RemoveRoute(pattern string) {
+	proxy.router.Remove(pattern)
+}
+
+// Run listens for and handles connections until the context is cancelled or
+// Shutdown is called. Cancelling the context shuts the proxy down as Shutdown
+// would, waiting up to ShutdownTimeout for sessions to end. Run returns nil
+// after a shutdown.
+func (proxy *Proxy) Run(ctx context.Context) (err error) {
 	log.Printf("Listening on %s", proxy.bindAddr.String())
 	
 	ln, err := net.Listen("tcp", proxy.bindAddr.String())
 	if err != nil {
-		proxy.Errors <- err
-		return
+		return err
+	}
+	
+	proxy.lock.Lock()
+	if proxy.shuttingDown {
+		proxy.lock.Unlock()
+		ln.Close()
+		return nil
 	}
+	proxy.listener = ln
+	proxy.lock.Unlock()
+	
+	stop := make(chan struct{})
+	defer close(stop)
+	
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), proxy.ShutdownTimeout)
+			defer cancel()
+			proxy.Shutdown(shutdownCtx)
+		
+		case <-stop:
+		}
+	}()
+	
+	go proxy.checkHealth(stop)
 	
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			proxy.Errors <- err
-			return
+			if proxy.isShuttingDown() {
+				if ctx.Err() != nil {
+					proxy.sessionsWG.Wait()
+				}
+				return nil
+			}
+			
+			ln.Close()
+			return err
+		}
+		
+		if !proxy.addSession() {
+			conn.Close()
+			continue
 		}
 		
 		go proxy.handleConnection(conn)
 	}
 }
 
+// RunAsync runs the proxy in the background, reporting an error (if any) on
+// the Errors channel and closing it when the proxy stops.
+func (proxy *Proxy) RunAsync() {
+	defer close(proxy.Errors)
+	
+	err := proxy.Run(context.Background())
+	if err != nil {
+		proxy.Errors <- err
+	}
+}
+
+// Shutdown stops the proxy accepting connections, disconnects every player with
+// ShutdownMessage and waits for their sessions to end. If the context expires
+// first, the remaining connections are closed and the context's error is
+// returned.
+func (proxy *Proxy) Shutdown(ctx context.Context) (err error) {
+	proxy.lock.Lock()
+	proxy.shuttingDown = true
+	ln := proxy.listener
+	sessions := make([]*Session, 0, len(proxy.sessions))
+	for sess := range proxy.sessions {
+		sessions = append(sessions, sess)
+	}
+	proxy.lock.Unlock()
+	
+	log.Printf("Shutting down")
+	
+	if ln != nil {
+		ln.Close()
+	}
+	
+	for _, sess := range sessions {
+		sess.close(proxy.ShutdownMessage)
+	}
+	
+	finished := make(chan struct{})
+	go func() {
+		proxy.sessionsWG.Wait()
+		close(finished)
+	}()
+	
+	select {
+	case <-finished:
+		return nil
+	
+	case <-ctx.Done():
+		proxy.lock.Lock()
+		for sess := range proxy.sessions {
+			sess.forceClose()
+		}
+		proxy.lock.Unlock()
+		
+		return ctx.Err()
+	}
+}
+
+func (proxy *Proxy) isShuttingDown() bool {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	
+	return proxy.shuttingDown
+}
+
+// addSession reserves a place for a new session, unless the proxy is shutting
+// down.
+func (proxy *Proxy) addSession() (ok bool) {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	
+	if proxy.shuttingDown {
+		return false
+	}
+	
+	proxy.sessionsWG.Add(1)
+	return true
+}
+
 func (proxy *Proxy) handleConnection(clientConn net.Conn) {
+	defer proxy.sessionsWG.Done()
 	defer clientConn.Close()
 	
 	log.Printf("Recieved connection from %s", clientConn.RemoteAddr().String())
-	log.Printf("Connecting to %s", proxy.serverAddr.String())
 	
-	serverConn, err := net.Dial("tcp", proxy.serverAddr.String())
-	if err != nil {
-		log.Printf("Session error: %s", err.Error())
+	sess := newSession(proxy, clientConn)
+	if sess == nil {
 		return
 	}
-	defer serverConn.Close()
 	
-	sess := newSession(proxy, clientConn, serverConn)
-	if sess == nil {
-		return
+	proxy.lock.Lock()
+	proxy.sessions[sess] = struct{}{}
+	if proxy.shuttingDown {
+		sess.close(proxy.ShutdownMessage)
 	}
+	proxy.lock.Unlock()
+	
+	defer func() {
+		proxy.lock.Lock()
+		delete(proxy.sessions, sess)
+		proxy.lock.Unlock()
+	}()
+	
+	// A bug in the session should only cost this one connection.
+	defer func() {
+		if x := recover(); x != nil {
+			log.Printf("Panic caught in session: %v", x)
+		}
+	}()
 	
-	err = sess.Run()
+	err := sess.Run()
 	if err != nil {
 		log.Printf("Session error: %s", err.Error())
 	}
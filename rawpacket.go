@@ -0,0 +1,32 @@
+package proxy
+
+// RawPacket is a packet whose body has not been decoded. Raw handlers receive
+// every packet in this form, whether or not a packet type is registered for
+// it, and it can also be passed to Session.Send to send an arbitrary packet.
+type RawPacket struct {
+	PacketID PacketID
+	Data []byte
+}
+
+func (packet *RawPacket) ID() (id PacketID) {
+	return packet.PacketID
+}
+
+func (packet *RawPacket) Read(r BinaryReader) (err error) {
+	packet.Data, err = r.ReadRemaining()
+	return err
+}
+
+func (packet *RawPacket) Write(w BinaryWriter) (err error) {
+	return w.WriteBytes(packet.Data)
+}
+
+// A RawHandler is called with packets before they are decoded. It may modify
+// the packet's data or ID (including its direction), and returns false to drop
+// the packet.
+type RawHandler func(*Session, *RawPacket) bool
+
+type rawHandlerKey struct {
+	State State
+	Direction Direction
+}
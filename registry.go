@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Registry maps the packet IDs used in each protocol version to packet types.
+//
+// A packet type is known to the registry in one of three ways:
+//   - Register maps an ID in a single protocol version to it.
+//   - If it implements VersionedPacket, its VersionID method is asked.
+//   - Otherwise, its ID method gives its ID in every version for which it has
+//     not been registered explicitly.
+type Registry struct {
+	lock sync.RWMutex
+	types map[PacketID]reflect.Type
+	versioned []reflect.Type
+	explicit map[uint64]map[PacketID]reflect.Type
+	explicitIDs map[reflect.Type]map[uint64]PacketID
+	index map[uint64]map[PacketID][]reflect.Type
+}
+
+func NewRegistry() (reg *Registry) {
+	return &Registry{
+		types: make(map[PacketID]reflect.Type),
+		explicit: make(map[uint64]map[PacketID]reflect.Type),
+		explicitIDs: make(map[reflect.Type]map[uint64]PacketID),
+		index: make(map[uint64]map[PacketID][]reflect.Type),
+	}
+}
+
+// Add makes a packet type known to the registry, using its VersionID method if
+// it is a VersionedPacket or its ID method otherwise.
+func (reg *Registry) Add(packet Packet) {
+	t := packetType(packet)
+	
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	
+	if _, ok := packet.(VersionedPacket); ok {
+		for _, vt := range reg.versioned {
+			if vt == t {
+				return
+			}
+		}
+		
+		reg.versioned = append(reg.versioned, t)
+		reg.index = make(map[uint64]map[PacketID][]reflect.Type)
+	
+	} else {
+		reg.types[packet.ID()] = t
+	}
+}
+
+// Register maps a packet ID in a protocol version to the type of packet.
+func (reg *Registry) Register(version uint64, id PacketID, packet Packet) {
+	t := packetType(packet)
+	
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	
+	if reg.explicit[version] == nil {
+		reg.explicit[version] = make(map[PacketID]reflect.Type)
+	}
+	reg.explicit[version][id] = t
+	
+	if reg.explicitIDs[t] == nil {
+		reg.explicitIDs[t] = make(map[uint64]PacketID)
+	}
+	reg.explicitIDs[t][version] = id
+}
+
+// Lookup returns a new packet of the type with the given ID in a protocol
+// version, or nil if there is none.
+func (reg *Registry) Lookup(version uint64, id PacketID) (packet Packet) {
+	types := reg.lookupTypes(version, id)
+	if len(types) == 0 {
+		return nil
+	}
+	
+	return newPacket(types[0])
+}
+
+// lookupTypes returns the types that have the given ID in a protocol version,
+// most specific first: an explicit registration, then versioned packets, then
+// packets identified by their ID method.
+func (reg *Registry) lookupTypes(version uint64, id PacketID) (types []reflect.Type) {
+	reg.lock.RLock()
+	index, indexed := reg.index[version]
+	reg.lock.RUnlock()
+	
+	if !indexed {
+		index = reg.buildIndex(version)
+	}
+	
+	reg.lock.RLock()
+	defer reg.lock.RUnlock()
+	
+	t, ok := reg.explicit[version][id]
+	if ok {
+		types = append(types, t)
+	}
+	
+	types = append(types, index[id]...)
+	
+	t, ok = reg.types[id]
+	if ok {
+		_, moved := reg.explicitIDs[t][version]
+		if !moved {
+			types = append(types, t)
+		}
+	}
+	
+	return types
+}
+
+// buildIndex records the IDs of the versioned packet types in the given
+// protocol version.
+func (reg *Registry) buildIndex(version uint64) (index map[PacketID][]reflect.Type) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	
+	index = make(map[PacketID][]reflect.Type)
+	for _, t := range reg.versioned {
+		id, ok := newPacket(t).(VersionedPacket).VersionID(version)
+		if ok {
+			index[id] = append(index[id], t)
+		}
+	}
+	
+	reg.index[version] = index
+	return index
+}
+
+// ID returns the ID of a packet in the given protocol version.
+func (reg *Registry) ID(packet Packet, version uint64) (id PacketID, err error) {
+	reg.lock.RLock()
+	id, ok := reg.explicitIDs[packetType(packet)][version]
+	reg.lock.RUnlock()
+	
+	if ok {
+		return id, nil
+	}
+	
+	vp, ok := packet.(VersionedPacket)
+	if !ok {
+		return packet.ID(), nil
+	}
+	
+	id, ok = vp.VersionID(version)
+	if !ok {
+		return id, fmt.Errorf("%T is not supported in protocol version %d", packet, version)
+	}
+	
+	return id, nil
+}
+
+func (reg *Registry) decode(packetData []byte, packet Packet, version uint64) (err error) {
+	id, err := reg.ID(packet, version)
+	if err != nil {
+		return err
+	}
+	
+	r := NewVersionedBinaryReader(bytes.NewReader(packetData), version)
+	idNum, _ := r.ReadVarint()
+	if idNum != id.Number {
+		return fmt.Errorf("Unexpected %s:%s:%X packet (expecting %s:%s:%X)", id.State.String(), id.Direction.String(), idNum, id.State.String(), id.Direction.String(), id.Number)
+	}
+	
+	err = packet.Read(r)
+	if err != nil {
+		return packetError(id, err)
+	}
+	
+	//fmt.Printf("recv %#v\n", packet)
+	
+	return nil
+}
+
+func (reg *Registry) encode(packet Packet, version uint64) (packetData []byte, err error) {
+	id, err := reg.ID(packet, version)
+	if err != nil {
+		return nil, err
+	}
+	
+	buf := bytes.NewBuffer(nil)
+	w := NewVersionedBinaryWriter(buf, version)
+	
+	err = w.WriteVarint(id.Number)
+	if err != nil {
+		return nil, err
+	}
+	
+	err = packet.Write(w)
+	if err != nil {
+		return nil, err
+	}
+	
+	return buf.Bytes(), nil
+}
+
+// playNumbers gives the number of each Play packet in the protocol versions it
+// is known in, by the name of its type in the packets catalogue. It is the only
+// copy of these numbers: the proxy's own packets, the message helpers and the
+// catalogue all take their numbers from it, so they agree on which versions
+// each packet is supported in. Packets whose layouts are only known up to some
+// version are only listed up to it.
+var playNumbers = map[string]map[uint64]uint64{
+	"ClientboundKeepAlive": {4: 0x00, 5: 0x00, 47: 0x00, 340: 0x1F, 754: 0x1F, 763: 0x23},
+	"ServerboundKeepAlive": {4: 0x00, 5: 0x00, 47: 0x00, 340: 0x0B, 754: 0x10, 763: 0x12},
+	"JoinGame": {4: 0x01, 5: 0x01, 47: 0x01, 340: 0x23},
+	"Respawn": {4: 0x07, 5: 0x07, 47: 0x07, 340: 0x35},
+	"Disconnect": {4: 0x40, 5: 0x40, 47: 0x40, 340: 0x1A, 754: 0x19, 763: 0x1A},
+	"ClientboundChatMessage": {4: 0x02, 5: 0x02, 47: 0x02, 340: 0x0F, 754: 0x0E, 763: 0x64},
+	"ServerboundChatMessage": {4: 0x01, 5: 0x01, 47: 0x01, 340: 0x02, 754: 0x03, 763: 0x05},
+	"ChatCommand": {763: 0x04},
+	"ClientboundPluginMessage": {4: 0x3F, 5: 0x3F, 47: 0x3F, 340: 0x18, 754: 0x17, 763: 0x17},
+	"ServerboundPluginMessage": {4: 0x17, 5: 0x17, 47: 0x17, 340: 0x09, 754: 0x0B, 763: 0x0D},
+	"PlayerListHeaderFooter": {47: 0x47, 340: 0x4A, 754: 0x53, 763: 0x65},
+	"Title": {47: 0x45, 340: 0x48, 754: 0x4F},
+	"SetTitleText": {763: 0x5F},
+	"SetSubtitleText": {763: 0x5D},
+	"SetActionBarText": {763: 0x46},
+	"SetTitleTimes": {763: 0x60},
+	"ClearTitles": {763: 0x0E},
+}
+
+// PlayNumbers returns the number of a Play packet in each protocol version it
+// is known in, by the name of its type in the packets catalogue, or nil if the
+// packet is not known.
+func PlayNumbers(name string) (numbers map[uint64]uint64) {
+	table, ok := playNumbers[name]
+	if !ok {
+		return nil
+	}
+	
+	numbers = make(map[uint64]uint64, len(table))
+	for version, number := range table {
+		numbers[version] = number
+	}
+	
+	return numbers
+}
+
+// SupportedVersion reports whether players can log in through the proxy with a
+// protocol version. These are the versions whose Play packets the proxy knows:
+// 1.7.2 (4), 1.7.10 (5), 1.8 (47), 1.12.2 (340), 1.16.5 (754) and 1.20.1 (763).
+// Players using any other version are refused when they log in, as the proxy
+// would not be able to kick them or send them messages. Status pings are
+// passed on in every version.
+func SupportedVersion(version uint64) (ok bool) {
+	_, ok = playNumbers["Disconnect"][version]
+	return ok
+}
+
+// playID returns the ID of a Play packet, by its name in playNumbers, in a
+// protocol version.
+func playID(name string, dir Direction, version uint64) (id PacketID, ok bool) {
+	number, ok := playNumbers[name][version]
+	return PacketID{Play, dir, number}, ok
+}
+
+// newCoreRegistry returns a registry containing the packets used by the proxy
+// itself.
+func newCoreRegistry() (reg *Registry) {
+	reg = NewRegistry()
+	
+	reg.Add(&HS0HandshakePacket{})
+	reg.Add(&PC1JoinGamePacket{})
+	reg.Add(&PC7RespawnPacket{})
+	reg.Add(&PC40DisconnectPacket{})
+	reg.Add(&LC0DisconnectPacket{})
+	reg.Add(&LC1EncryptionRequestPacket{})
+	reg.Add(&LC2LoginSuccessPacket{})
+	reg.Add(&LC3SetCompressionPacket{})
+	reg.Add(&LC4LoginPluginRequestPacket{})
+	reg.Add(&LS0LoginStartPacket{})
+	reg.Add(&LS1EncryptionResponsePacket{})
+	reg.Add(&LS2LoginPluginResponsePacket{})
+	reg.Add(&SC0StatusResponsePacket{})
+	reg.Add(&SC1StatusPongPacket{})
+	reg.Add(&SS0StatusRequestPacket{})
+	reg.Add(&SS1StatusPingPacket{})
+	
+	return reg
+}
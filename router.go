@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+)
+
+// router maps the hostname a client connected with to the addresses of the
+// servers its connection may be forwarded to, in order of preference.
+type router struct {
+	lock sync.RWMutex
+	exact map[string][]Address
+	wildcards map[string][]Address
+	defaultAddrs []Address
+}
+
+func newRouter() (rt *router) {
+	return &router{
+		exact: make(map[string][]Address),
+		wildcards: make(map[string][]Address),
+	}
+}
+
+// Add adds a route. The pattern is either a hostname, a wildcard of the form
+// "*.example.net" matching any subdomain of example.net, or "*" (or the empty
+// string) to match any hostname not matched by another route.
+func (rt *router) Add(pattern string, serverAddrs []Address) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	
+	pattern = normaliseHostname(pattern)
+	
+	switch {
+	case pattern == "" || pattern == "*":
+		rt.defaultAddrs = serverAddrs
+	case strings.HasPrefix(pattern, "*."):
+		rt.wildcards[pattern[1:]] = serverAddrs
+	default:
+		rt.exact[pattern] = serverAddrs
+	}
+}
+
+func (rt *router) Remove(pattern string) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	
+	pattern = normaliseHostname(pattern)
+	
+	switch {
+	case pattern == "" || pattern == "*":
+		rt.defaultAddrs = nil
+	case strings.HasPrefix(pattern, "*."):
+		delete(rt.wildcards, pattern[1:])
+	default:
+		delete(rt.exact, pattern)
+	}
+}
+
+// Lookup finds the servers for a hostname. Exact routes take priority over
+// wildcards, and longer wildcards over shorter ones.
+func (rt *router) Lookup(hostname string) (serverAddrs []Address, ok bool) {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+	
+	hostname = normaliseHostname(hostname)
+	
+	serverAddrs, ok = rt.exact[hostname]
+	if ok {
+		return serverAddrs, true
+	}
+	
+	bestSuffix := ""
+	for suffix, addrs := range rt.wildcards {
+		if strings.HasSuffix(hostname, suffix) && len(suffix) > len(bestSuffix) {
+			bestSuffix = suffix
+			serverAddrs = addrs
+		}
+	}
+	
+	if bestSuffix != "" {
+		return serverAddrs, true
+	}
+	
+	if rt.defaultAddrs != nil {
+		return rt.defaultAddrs, true
+	}
+	
+	return nil, false
+}
+
+// Servers returns every server that can be routed to.
+func (rt *router) Servers() (serverAddrs []Address) {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+	
+	seen := make(map[Address]bool)
+	add := func(addrs []Address) {
+		for _, addr := range addrs {
+			if !seen[addr] {
+				seen[addr] = true
+				serverAddrs = append(serverAddrs, addr)
+			}
+		}
+	}
+	
+	add(rt.defaultAddrs)
+	for _, addrs := range rt.exact {
+		add(addrs)
+	}
+	for _, addrs := range rt.wildcards {
+		add(addrs)
+	}
+	
+	return serverAddrs
+}
+
+// normaliseHostname strips what clients may append to the hostname in the
+// handshake (such as Forge's "\x00FML\x00" marker or a trailing dot) and
+// lowercases it.
+func normaliseHostname(hostname string) string {
+	if i := strings.IndexByte(hostname, 0); i >= 0 {
+		hostname = hostname[:i]
+	}
+	
+	hostname = strings.TrimSuffix(hostname, ".")
+	return strings.ToLower(hostname)
+}
@@ -1,19 +1,17 @@
 package proxy
 
 import (
-	"bytes"
 	"crypto/rsa"
-	"encoding/json"
-	"fmt"
 	"io"
 	"log"
-	"net/http"
 )
 
 import crand "crypto/rand"
 
 type serverEncryptionManager struct {
 	gem *globalEncryptionManager
+	auth AuthService
+	tokenFile string
 	accessToken string
 	clientToken string
 	selectedProfileID string
@@ -24,9 +22,11 @@ type serverEncryptionManager struct {
 	sharedSecret []byte
 }
 
-func (gem *globalEncryptionManager) newServer() (sem *serverEncryptionManager, err error) {
+func (gem *globalEncryptionManager) newServer(auth AuthService, tokenFile string) (sem *serverEncryptionManager, err error) {
 	sem = &serverEncryptionManager{
 		gem: gem,
+		auth: auth,
+		tokenFile: tokenFile,
 	}
 	
 	return sem, nil
@@ -35,40 +35,14 @@ func (gem *globalEncryptionManager) newServer() (sem *serverEncryptionManager, e
 func (sem *serverEncryptionManager) authenticate() (err error) {
 	log.Printf("authenticate")
 	
-	requestMessage := authenticateRequest{
-		Agent: authenticateAgent{
-			Name: "Minecraft",
-			Version: 1,
-		},
-		Username: sem.gem.username,
-		Password: sem.gem.password,
-	}
-	
-	requestJson, err := json.Marshal(requestMessage)
-	if err != nil {
-		return err
-	}
-	
-	resp, err := http.Post("https://authserver.mojang.com/authenticate", "application/json", bytes.NewReader(requestJson))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("HTTP authentication error: %s", resp.Status)
-	}
-	
-	var responseMessage authenticateResponse
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&responseMessage)
+	session, err := sem.gem.authenticate(sem.auth, sem.tokenFile)
 	if err != nil {
 		return err
 	}
 	
-	sem.accessToken = responseMessage.AccessToken
-	sem.clientToken = responseMessage.ClientToken
-	sem.selectedProfileID = responseMessage.SelectedProfile.ID
+	sem.accessToken = session.AccessToken
+	sem.clientToken = session.ClientToken
+	sem.selectedProfileID = session.Profile.ID
 	
 	return nil
 }
@@ -98,28 +72,7 @@ func (sem *serverEncryptionManager) notifyJoin() (err error) {
 	log.Printf("notifyJoin")
 	
 	serverHash := AuthDigest(sem.remoteServerID, sem.sharedSecret, sem.remotePublicKeyBytes)
-	requestMessage := notifyJoinRequest{
-		AccessToken: sem.accessToken,
-		SelectedProfile: sem.selectedProfileID,
-		ServerID: serverHash,
-	}
-	
-	requestJson, err := json.Marshal(requestMessage)
-	if err != nil {
-		return err
-	}
-	
-	resp, err := http.Post("https://sessionserver.mojang.com/session/minecraft/join", "application/json", bytes.NewReader(requestJson))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("HTTP authentication error: %s", resp.Status)
-	}
-	
-	return nil
+	return sem.auth.Join(sem.accessToken, sem.selectedProfileID, serverHash)
 }
 
 func (sem *serverEncryptionManager) makeEncryptionResponse() (packet *LS1EncryptionResponsePacket, err error) {
@@ -140,34 +93,3 @@ func (sem *serverEncryptionManager) makeEncryptionResponse() (packet *LS1Encrypt
 	
 	return packet, nil
 }
-
-type authenticateRequest struct {
-	Agent authenticateAgent `json:"agent"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	ClientToken string `json:"clientToken,omitempty"`
-}
-
-type authenticateAgent struct {
-	Name string `json:"name"`
-	Version int `json:"version"`
-}
-
-type authenticateResponse struct {
-	AccessToken string `json:"accessToken"`
-	ClientToken string `json:"clientToken"`
-	AvailableProfiles []authenticateProfile `json:"availableProfiles"`
-	SelectedProfile authenticateProfile `json:"selectedProfile"`
-}
-
-type authenticateProfile struct {
-	ID string `json:"id"`
-	Name string `json:"name"`
-	Legacy bool `json:"legacy,omitempty"`
-}
-
-type notifyJoinRequest struct {
-	AccessToken string `json:"accessToken"`
-	SelectedProfile string `json:"selectedProfile"`
-	ServerID string `json:"serverId"`
-}
@@ -1,13 +1,25 @@
 package proxy
 
 import (
-	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"github.com/kierdavis/proxy/chat"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
+// ErrSessionClosed is returned when sending a packet on a session that has been
+// closed or has ended.
+var ErrSessionClosed = errors.New("Session closed")
+
+// ErrSendQueueFull is returned by TrySend when the packet can't be queued
+// without waiting.
+var ErrSendQueueFull = errors.New("Send queue full")
+
 type Session struct {
 	Proxy *Proxy
 	
@@ -23,44 +35,182 @@ type Session struct {
 	
 	// Handshake info
 	ProtocolVersion uint64
+	Hostname string
+	ServerAddr Address
 	handshakeNextState uint64
 	
+	// The handshake is held back from the server until the player has logged
+	// in to the proxy, so that nothing is sent upstream for a player that
+	// fails to authenticate.
+	handshake *HS0HandshakePacket
+	
 	// Login info
 	PlayerName string
 	UUID string
 	
-	outgoingChan chan Packet
+	outgoingChan chan outgoingPacket
+	clientOutgoing chan []byte
+	serverIncoming chan []byte
+	serverOutgoing chan []byte
+	serverErrs chan error
+	serverDone chan struct{}
+	serverWriterFinished chan struct{}
+	switchChan chan *serverSwitch
+	
+	// Held while the connections are being changed. switching is guarded by
+	// it and set while Connect is logging in to a new server.
+	connLock sync.Mutex
+	switching bool
+	
+	// Held while a packet is forwarded, so that the loop can replace the
+	// server connection without racing the forwarder.
+	forwardLock sync.Mutex
+	
+	// Guards sendState, the state packets are being passed in. passing is set
+	// once passPackets has started, and Send can only be used after that.
+	sendLock sync.Mutex
+	sendState State
+	passing bool
+	
+	closeOnce sync.Once
+	closing chan struct{}
+	closeMessage *chat.Component
+	finishOnce sync.Once
+	finished chan struct{}
+}
+
+// outgoingPacket is a packet sent with Send, encoded and waiting to be
+// forwarded.
+type outgoingPacket struct {
+	data []byte
+	dir Direction
 }
 
-func newSession(proxy *Proxy, clientConn net.Conn, serverConn net.Conn) (s *Session) {
+func newSession(proxy *Proxy, clientConn net.Conn) (s *Session) {
 	s = &Session{
 		Proxy: proxy,
 		clientConn: clientConn,
-		serverConn: serverConn,
 		clientCodec: newCodec(clientConn),
-		serverCodec: newCodec(serverConn),
 		state: Handshaking,
+		outgoingChan: make(chan outgoingPacket, 10),
+		switchChan: make(chan *serverSwitch, 1),
+		closing: make(chan struct{}),
+		finished: make(chan struct{}),
 	}
 	
 	return s
 }
 
 func (s *Session) Run() (err error) {
+	defer func() {
+		if s.serverConn != nil {
+			s.serverConn.Close()
+		}
+	}()
+	
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.watchClose(stop)
+	
+	defer s.finish()
+	
+	s.Proxy.hm.Fire(s, &ConnectEvent{s.clientConn.RemoteAddr()})
+	
 	err = s.run()
-	if err != nil {
-		switch s.state {
-		case Play:
-			s.send(&PC40DisconnectPacket{"{\"text\":\"Internal proxy error\"}"})
-		
-		case Login:
-			s.send(&LC0DisconnectPacket{"{\"text\":\"Internal proxy error\"}"})
+	defer func() {
+		s.Proxy.hm.Fire(s, &CloseEvent{err})
+	}()
+	
+	message := chat.Text("Internal proxy error")
+	if s.isClosing() {
+		if s.closeMessage != nil {
+			message = s.closeMessage
+		} else {
+			message = chat.Text("")
+		}
+		err = nil
+	} else if err == nil {
+		return nil
+	}
+	
+	var sendErr error
+	switch s.state {
+	case Play:
+		sendErr = s.send(&PC40DisconnectPacket{message.JSON()})
+	
+	case Login:
+		sendErr = s.send(&LC0DisconnectPacket{message.JSON()})
+	}
+	
+	if sendErr != nil {
+		log.Printf("Could not send disconnect packet: %s", sendErr.Error())
+		if err == nil {
+			err = sendErr
 		}
 	}
 	
 	return err
 }
 
+// close asks the session to disconnect the client with the given message. It
+// does not wait for the session to end.
+func (s *Session) close(message *chat.Component) {
+	s.closeOnce.Do(func() {
+		s.closeMessage = message
+		close(s.closing)
+	})
+}
+
+// finish marks the session as no longer accepting packets from Send.
+func (s *Session) finish() {
+	s.finishOnce.Do(func() {
+		close(s.finished)
+	})
+}
+
+func (s *Session) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// watchClose interrupts any blocked reads when the session is closed, so that
+// it doesn't have to wait for either side to send something.
+func (s *Session) watchClose(stop chan struct{}) {
+	select {
+	case <-s.closing:
+		s.connLock.Lock()
+		defer s.connLock.Unlock()
+		
+		now := time.Now()
+		s.clientConn.SetReadDeadline(now)
+		if s.serverConn != nil {
+			s.serverConn.SetReadDeadline(now)
+		}
+	
+	case <-stop:
+	}
+}
+
+// forceClose closes both connections, abandoning anything still being sent.
+func (s *Session) forceClose() {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	
+	s.clientConn.Close()
+	if s.serverConn != nil {
+		s.serverConn.Close()
+	}
+}
+
 func (s *Session) run() (err error) {
+	if s.isLegacyPing() {
+		return s.answerLegacyPing()
+	}
+	
 	err = s.passHandshake()
 	if err != nil {
 		return err
@@ -68,8 +218,17 @@ func (s *Session) run() (err error) {
 	
 	switch s.handshakeNextState {
 	case 1:
+		if s.serverConn == nil {
+			return s.answerStatus()
+		}
 		return s.doStatus()
 	case 2:
+		if !SupportedVersion(s.ProtocolVersion) {
+			return s.refuseLogin(fmt.Sprintf("unsupported protocol version %d", s.ProtocolVersion), s.Proxy.UnsupportedVersionMessage)
+		}
+		if s.serverConn == nil {
+			return s.refuseLogin("server is offline", s.Proxy.OfflineMessage)
+		}
 		return s.doLogin()
 	}
 	
@@ -81,180 +240,372 @@ func (s *Session) doStatus() (err error) {
 	return s.passPackets()
 }
 
+// refuseLogin disconnects a player trying to log in with the given message,
+// when the server can't be reached or the player's version isn't supported.
+func (s *Session) refuseLogin(why string, message *chat.Component) (err error) {
+	s.setState(Login)
+	
+	packet := &LS0LoginStartPacket{}
+	err = s.recv(packet)
+	if err != nil {
+		return err
+	}
+	
+	s.PlayerName = packet.Name
+	log.Printf("Refusing login from %s: %s", s.PlayerName, why)
+	
+	// Run sends the disconnect packet.
+	s.close(message)
+	return nil
+}
+
 func (s *Session) doLogin() (err error) {
 	s.setState(Login)
 	
-	err = s.passLoginStart()
+	loginStart := &LS0LoginStartPacket{}
+	err = s.recv(loginStart)
 	if err != nil {
 		return err
 	}
 	
-	/*
-	cem, err := s.Proxy.gem.newClient(s.PlayerName)
+	s.PlayerName = loginStart.Name
+	
+	if s.Proxy.OnlineMode {
+		err = s.authenticateClient(loginStart.Key)
+		if err != nil {
+			return err
+		}
+	}
+	
+	err = s.write(s.serverCodec, s.handshake)
 	if err != nil {
 		return err
 	}
-	*/
 	
-	sem, err := s.Proxy.gem.newServer()
+	err = s.send(loginStart)
 	if err != nil {
 		return err
 	}
 	
-	//s.cem = cem
-	s.sem = sem
+	// What the server sends next depends on how it is configured: an
+	// offline-mode server never asks for encryption, and compression and
+	// plugin requests are optional.
+	for {
+		packetData, err := s.serverCodec.Read()
+		if err != nil {
+			return err
+		}
+		
+		switch idNum := packetNumber(packetData); idNum {
+		case (&LC0DisconnectPacket{}).ID().Number:
+			packet := &LC0DisconnectPacket{}
+			err = s.decode(packetData, packet)
+			if err != nil {
+				return err
+			}
+			
+			log.Printf("Server refused login: %s", packet.JsonData)
+			
+			// Run passes the reason on to the client.
+			reason, err := chat.ParseJSON(packet.JsonData)
+			if err != nil {
+				reason = chat.Text(packet.JsonData)
+			}
+			s.close(reason)
+			return nil
+		
+		case (&LC1EncryptionRequestPacket{}).ID().Number:
+			s.sem, err = s.encryptServer(s.serverCodec, packetData)
+		
+		case (&LC3SetCompressionPacket{}).ID().Number:
+			err = s.passSetCompression(packetData)
+		
+		case (&LC4LoginPluginRequestPacket{}).ID().Number:
+			err = s.passLoginPluginRequest(packetData)
+		
+		case (&LC2LoginSuccessPacket{}).ID().Number:
+			err = s.passLoginSuccess(packetData)
+			if err != nil {
+				return err
+			}
+			
+			log.Printf("Login successful")
+			
+			s.Proxy.hm.Fire(s, &LoginEvent{s.PlayerName, s.UUID})
+			
+			s.setState(Play)
+			return s.passPackets()
+		
+		default:
+			err = fmt.Errorf("Unexpected %s packet during login", PacketID{Login, Clientbound, idNum}.String())
+		}
+		
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// encryptServer answers the server's Encryption Request with our own account's
+// credentials and enables encryption on the server connection.
+func (s *Session) encryptServer(c *codec, packetData []byte) (sem *serverEncryptionManager, err error) {
+	request := &LC1EncryptionRequestPacket{}
+	err = s.decode(packetData, request)
+	if err != nil {
+		return nil, err
+	}
 	
-	err = s.sem.authenticate()
+	sem, err = s.Proxy.gem.newServer(s.Proxy.AuthService, s.Proxy.TokenFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	err = s.readEncryptionRequest()
+	err = sem.authenticate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	/*
-	err = s.writeEncryptionRequest()
+	err = sem.handleEncryptionRequest(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	*/
 	
-	err = s.sem.generateSharedSecret()
+	err = sem.generateSharedSecret()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	err = s.sem.notifyJoin()
+	err = sem.notifyJoin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	/*
-	err = s.readEncryptionResponse()
+	response, err := sem.makeEncryptionResponse()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	*/
 	
-	err = s.writeEncryptionResponse()
+	err = s.write(c, response)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	/*
-	err = s.cem.notifyHasJoined()
+	err = c.Encrypt(sem.sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	
+	return sem, nil
+}
+
+func (s *Session) authenticateClient(playerKey *LoginKey) (err error) {
+	cem, err := s.Proxy.gem.newClient(s.PlayerName, playerKey, s.Proxy.AuthService)
 	if err != nil {
 		return err
 	}
-	*/
 	
-	/*
-	err = s.clientCodec.Encrypt(s.cem.sharedSecret)
+	s.cem = cem
+	
+	err = s.writeEncryptionRequest()
 	if err != nil {
 		return err
 	}
-	*/
 	
-	err = s.serverCodec.Encrypt(s.sem.sharedSecret)
+	err = s.readEncryptionResponse()
 	if err != nil {
 		return err
 	}
 	
-	err = s.passLoginSuccess()
+	err = s.cem.notifyHasJoined()
 	if err != nil {
 		return err
 	}
 	
-	log.Printf("Login successful")
+	err = s.clientCodec.Encrypt(s.cem.sharedSecret)
+	if err != nil {
+		return err
+	}
 	
-	s.setState(Play)
-	return s.passPackets()
+	log.Printf("Authenticated client %s (%s)", s.cem.playerName, s.cem.playerUUID)
+	return nil
 }
 
 func (s *Session) passPackets() (err error) {
-	errs := make(chan error, 1)
+	clientErrs := make(chan error, 2)
 	clientIncoming := make(chan []byte, 10)
-	serverIncoming := make(chan []byte, 10)
-	clientOutgoing := make(chan []byte, 10)
-	serverOutgoing := make(chan []byte, 10)
-	outgoing := make(chan Packet, 10)
-	
-	s.outgoingChan = outgoing
-	
-	go s.clientCodec.ReadAll(clientIncoming, errs)
-	go s.serverCodec.ReadAll(serverIncoming, errs)
-	go s.clientCodec.WriteAll(clientOutgoing, errs)
-	go s.serverCodec.WriteAll(serverOutgoing, errs)
-	
-	go func() {
-		for {
-			select {
-			case packetData := <-clientIncoming:
-				packetData, dir, accept := s.handlePacket(packetData, Serverbound)
-				if accept {
-					switch dir {
-					case Clientbound:
-						clientOutgoing <- packetData
-					case Serverbound:
-						serverOutgoing <- packetData
-					}
-				}
-			
-			case packetData := <-serverIncoming:
-				packetData, dir, accept := s.handlePacket(packetData, Clientbound)
-				if accept {
-					switch dir {
-					case Clientbound:
-						clientOutgoing <- packetData
-					case Serverbound:
-						serverOutgoing <- packetData
-					}
-				}
-			
-			case packet := <-outgoing:
-				buf := bytes.NewBuffer(nil)
-				w := NewBinaryWriter(buf)
-				w.WriteVarint(packet.ID().Number)
-				packet.Write(w)
-				
-				switch packet.ID().Direction {
-				case Clientbound:
-					clientOutgoing <- buf.Bytes()
-				case Serverbound:
-					serverOutgoing <- buf.Bytes()
-				}
+	clientDone := make(chan struct{})
+	clientWriterFinished := make(chan struct{})
+	forwarderStop := make(chan struct{})
+	forwarderDone := make(chan struct{})
+	
+	s.clientOutgoing = make(chan []byte, 10)
+	
+	go s.clientCodec.ReadAll(clientIncoming, clientErrs, clientDone)
+	go s.clientCodec.WriteAll(s.clientOutgoing, clientErrs, clientWriterFinished)
+	
+	s.startServer()
+	
+	s.sendLock.Lock()
+	s.sendState = s.state
+	s.passing = true
+	s.sendLock.Unlock()
+	
+	go s.forwardSent(forwarderStop, forwarderDone)
+	
+	// Once the loop below exits, stop the readers and wait for the writers to
+	// flush whatever is still queued.
+	defer func() {
+		s.finish()
+		close(forwarderStop)
+		<-forwarderDone
+		s.closeSwitch()
+		close(clientDone)
+		close(s.clientOutgoing)
+		s.stopServer()
+		<-clientWriterFinished
+		<-s.serverWriterFinished
+	}()
+	
+	for {
+		select {
+		case packetData := <-clientIncoming:
+			packetData, dir, accept, err := s.handlePacket(packetData, Serverbound)
+			if err != nil {
+				return err
+			}
+			if accept {
+				s.forward(packetData, dir)
+			}
+		
+		case packetData := <-s.serverIncoming:
+			packetData, dir, accept, err := s.handlePacket(packetData, Clientbound)
+			if err != nil {
+				return err
 			}
+			if accept {
+				s.forward(packetData, dir)
+			}
+		
+		case sw := <-s.switchChan:
+			err = s.switchServer(sw)
+			if err != nil {
+				return err
+			}
+		
+		case <-s.closing:
+			return nil
+		
+		case err = <-clientErrs:
+			return err
+		
+		case err = <-s.serverErrs:
+			return err
 		}
-	}()
+	}
+}
+
+// startServer starts the goroutines reading and writing packets on the
+// current server connection.
+func (s *Session) startServer() {
+	s.serverIncoming = make(chan []byte, 10)
+	s.serverOutgoing = make(chan []byte, 10)
+	s.serverErrs = make(chan error, 2)
+	s.serverDone = make(chan struct{})
+	s.serverWriterFinished = make(chan struct{})
+	
+	go s.serverCodec.ReadAll(s.serverIncoming, s.serverErrs, s.serverDone)
+	go s.serverCodec.WriteAll(s.serverOutgoing, s.serverErrs, s.serverWriterFinished)
+}
+
+// stopServer stops the goroutines started by startServer. The writer may still
+// be flushing when it returns.
+func (s *Session) stopServer() {
+	close(s.serverDone)
+	close(s.serverOutgoing)
+}
+
+// forwardSent forwards the packets queued by Send until stop is closed, then
+// closes done. It runs apart from the packet loop, so handlers can send packets
+// without waiting for the loop to get to them.
+func (s *Session) forwardSent(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	
+	for {
+		select {
+		case op := <-s.outgoingChan:
+			s.forward(op.data, op.dir)
+		
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Session) forward(packetData []byte, dir Direction) {
+	s.forwardLock.Lock()
+	defer s.forwardLock.Unlock()
 	
-	err = <-errs
-	time.Sleep(time.Second / 2)
-	return err
+	switch dir {
+	case Clientbound:
+		s.clientOutgoing <- packetData
+	case Serverbound:
+		s.serverOutgoing <- packetData
+	}
 }
 
-func (s *Session) handlePacket(packetData []byte, dir Direction) (newPacketData []byte, newDir Direction, accept bool) {
-	r := NewBinaryReader(bytes.NewReader(packetData))
-	idNum, _ := r.ReadVarint()
+func (s *Session) handlePacket(packetData []byte, dir Direction) (newPacketData []byte, newDir Direction, accept bool, err error) {
+	// n is 0 if the packet is empty and negative if the ID overflows.
+	idNum, n := binary.Uvarint(packetData)
+	if n <= 0 {
+		return nil, dir, false, fmt.Errorf("Invalid packet ID in %s:%s packet", s.state.String(), dir.String())
+	}
+	
 	id := PacketID{s.state, dir, idNum}
 	
-	packet := s.Proxy.hm.Lookup(id)
+	if id == (&SC0StatusResponsePacket{}).ID() {
+		packetData, err = s.handleStatusResponse(packetData)
+		if err != nil {
+			return nil, dir, false, err
+		}
+	}
+	
+	if s.Proxy.hm.HasRaw(id) {
+		raw := &RawPacket{id, packetData[n:]}
+		accept = s.Proxy.hm.ProcessRaw(s, raw)
+		if !accept {
+			return packetData, dir, false, nil
+		}
+		
+		packetData, err = s.encode(raw)
+		if err != nil {
+			return nil, dir, false, err
+		}
+		
+		id = raw.PacketID
+		dir = id.Direction
+	}
+	
+	packet := s.Proxy.hm.Lookup(id, s.ProtocolVersion)
 	if packet != nil {
-		packet.Read(r)
+		err = s.decode(packetData, packet)
+		if err != nil {
+			return nil, dir, false, err
+		}
+		
 		accept = s.Proxy.hm.Process(s, packet)
 		if !accept {
-			return packetData, dir, false
+			return packetData, dir, false, nil
 		}
 		
-		buf := bytes.NewBuffer(nil)
-		w := NewBinaryWriter(buf)
-		w.WriteVarint(packet.ID().Number)
-		packet.Write(w)
-		return buf.Bytes(), packet.ID().Direction, true
+		packetData, err = s.encode(packet)
+		if err != nil {
+			return nil, dir, false, err
+		}
+		
+		return packetData, packet.ID().Direction, true, nil
 	}
 	
-	return packetData, dir, true
+	return packetData, dir, true, nil
 }
 
 func (s *Session) passHandshake() (err error) {
@@ -265,34 +616,100 @@ func (s *Session) passHandshake() (err error) {
 	}
 	
 	s.ProtocolVersion = packet.ProtocolVersion
+	s.Hostname = normaliseHostname(packet.ServerAddress)
 	s.handshakeNextState = packet.NextState
 	
-	packet.ServerAddress = s.Proxy.serverAddr.Host
-	packet.ServerPort = uint16(s.Proxy.serverAddr.Port)
+	nextState := Handshaking
+	switch s.handshakeNextState {
+	case 1:
+		nextState = Status
+	case 2:
+		nextState = Login
+	}
+	
+	s.Proxy.hm.Fire(s, &HandshakeEvent{s.ProtocolVersion, s.Hostname, nextState})
+	
+	if nextState == Status && s.Proxy.StatusProvider != nil {
+		// The ping is answered without connecting to a server.
+		return nil
+	}
+	
+	if nextState == Login && !SupportedVersion(s.ProtocolVersion) {
+		// run refuses the login without connecting to a server.
+		return nil
+	}
+	
+	serverAddrs, ok := s.Proxy.router.Lookup(s.Hostname)
+	if !ok {
+		return fmt.Errorf("No route for hostname %q", s.Hostname)
+	}
+	
+	err = s.connectAny(serverAddrs)
+	if err != nil {
+		if nextState != Status && nextState != Login {
+			return err
+		}
+		
+		// Answer the client ourselves rather than leaving it with a closed
+		// connection.
+		s.ServerAddr = serverAddrs[0]
+		return nil
+	}
+	
+	packet.ServerAddress = s.ServerAddr.Host
+	packet.ServerPort = uint16(s.ServerAddr.Port)
+	
+	if nextState == Login {
+		// doLogin sends it once the player has logged in.
+		s.handshake = packet
+		return nil
+	}
 	
 	return s.send(packet)
 }
 
-func (s *Session) passLoginStart() (err error) {
-	packet := &LS0LoginStartPacket{}
-	err = s.recv(packet)
-	if err != nil {
-		return err
+// connectAny connects to the first of the servers that can be reached. Servers
+// that the latest health check found to be down are tried last.
+func (s *Session) connectAny(serverAddrs []Address) (err error) {
+	var up, down []Address
+	for _, addr := range serverAddrs {
+		if s.Proxy.ServerUp(addr) {
+			up = append(up, addr)
+		} else {
+			down = append(down, addr)
+		}
 	}
 	
-	s.PlayerName = packet.Name
+	err = fmt.Errorf("No servers to connect to")
+	for _, addr := range append(up, down...) {
+		err = s.connectServer(addr)
+		if err == nil {
+			return nil
+		}
+		
+		log.Printf("Could not connect to %s: %s", addr.String(), err.Error())
+	}
 	
-	return s.send(packet)
+	return err
 }
 
-func (s *Session) readEncryptionRequest() (err error) {
-	packet := &LC1EncryptionRequestPacket{}
-	err = s.recv(packet)
+func (s *Session) connectServer(serverAddr Address) (err error) {
+	log.Printf("Connecting to %s", serverAddr.String())
+	
+	serverConn, err := net.DialTimeout("tcp", serverAddr.String(), s.Proxy.ConnectTimeout)
 	if err != nil {
 		return err
 	}
 	
-	return s.sem.handleEncryptionRequest(packet)
+	s.connLock.Lock()
+	s.ServerAddr = serverAddr
+	s.serverConn = serverConn
+	s.serverCodec = newCodec(serverConn)
+	s.connLock.Unlock()
+	
+	s.Proxy.hm.Fire(s, &ServerConnectEvent{serverAddr})
+	
+	return nil
 }
 
 func (s *Session) writeEncryptionRequest() (err error) {
@@ -314,26 +731,60 @@ func (s *Session) readEncryptionResponse() (err error) {
 	return s.cem.handleEncryptionResponse(packet)
 }
 
-func (s *Session) writeEncryptionResponse() (err error) {
-	packet, err := s.sem.makeEncryptionResponse()
+func (s *Session) passLoginSuccess(packetData []byte) (err error) {
+	packet := &LC2LoginSuccessPacket{}
+	err = s.decode(packetData, packet)
 	if err != nil {
 		return err
 	}
 	
+	s.UUID = packet.UUID
+	s.PlayerName = packet.Username
+	
 	return s.send(packet)
 }
 
-func (s *Session) passLoginSuccess() (err error) {
-	packet := &LC2LoginSuccessPacket{}
-	err = s.recv(packet)
+func (s *Session) passSetCompression(packetData []byte) (err error) {
+	packet := &LC3SetCompressionPacket{}
+	err = s.decode(packetData, packet)
 	if err != nil {
 		return err
 	}
 	
-	s.UUID = packet.UUID
-	s.PlayerName = packet.Username
+	s.serverCodec.SetCompression(int(packet.Threshold))
 	
-	return s.send(packet)
+	if s.Proxy.ClientCompressionThreshold >= 0 {
+		packet.Threshold = int32(s.Proxy.ClientCompressionThreshold)
+	}
+	
+	err = s.send(packet)
+	if err != nil {
+		return err
+	}
+	
+	s.clientCodec.SetCompression(int(packet.Threshold))
+	return nil
+}
+
+func (s *Session) passLoginPluginRequest(packetData []byte) (err error) {
+	request := &LC4LoginPluginRequestPacket{}
+	err = s.decode(packetData, request)
+	if err != nil {
+		return err
+	}
+	
+	err = s.send(request)
+	if err != nil {
+		return err
+	}
+	
+	response := &LS2LoginPluginResponsePacket{}
+	err = s.recv(response)
+	if err != nil {
+		return err
+	}
+	
+	return s.send(response)
 }
 
 func (s *Session) recv(packet Packet) (err error) {
@@ -355,17 +806,30 @@ func (s *Session) recv(packet Packet) (err error) {
 		return err
 	}
 	
-	r := NewBinaryReader(bytes.NewReader(packetData))
-	idNum, _ := r.ReadVarint()
-	if idNum != id.Number {
-		return fmt.Errorf("Unexpected %s:%s:%X packet (expecting %s:%s:%X)", id.State.String(), id.Direction.String(), idNum, id.State.String(), id.Direction.String(), id.Number)
+	return s.decode(packetData, packet)
+}
+
+func (s *Session) decode(packetData []byte, packet Packet) (err error) {
+	return s.Proxy.registry.decode(packetData, packet, s.ProtocolVersion)
+}
+
+func (s *Session) encode(packet Packet) (packetData []byte, err error) {
+	return s.Proxy.registry.encode(packet, s.ProtocolVersion)
+}
+
+// write encodes a packet and writes it to a connection.
+func (s *Session) write(c *codec, packet Packet) (err error) {
+	packetData, err := s.encode(packet)
+	if err != nil {
+		return err
 	}
 	
-	packet.Read(r)
-	
-	//fmt.Printf("recv %#v\n", packet)
-	
-	return nil
+	return c.Write(packetData)
+}
+
+func packetNumber(packetData []byte) (number uint64) {
+	number, _ = binary.Uvarint(packetData)
+	return number
 }
 
 func (s *Session) send(packet Packet) (err error) {
@@ -384,31 +848,106 @@ func (s *Session) send(packet Packet) (err error) {
 		c = s.serverCodec
 	}
 	
-	buf := bytes.NewBuffer(nil)
-	w := NewBinaryWriter(buf)
-	w.WriteVarint(id.Number)
-	packet.Write(w)
+	return s.write(c, packet)
+}
+
+// Send sends a packet to the client or server, depending on its direction. The
+// packet is queued to be sent alongside the packets being passed through, and
+// Send returns once it has been queued. The queue is emptied apart from the
+// packet loop, so Send may be called from handlers too. Packets can only be
+// sent once the session is passing packets in the Status or Play state, and
+// only in that state; otherwise an error is returned. Send returns
+// ErrSessionClosed if the session has been closed or has ended.
+func (s *Session) Send(packet Packet) (err error) {
+	return s.SendContext(context.Background(), packet)
+}
+
+// SendContext is like Send, but gives up waiting for space in the queue when
+// the context is done, returning the context's error.
+func (s *Session) SendContext(ctx context.Context, packet Packet) (err error) {
+	op, err := s.prepareSend(packet)
+	if err != nil {
+		return err
+	}
 	
-	err = c.Write(buf.Bytes())
+	select {
+	case s.outgoingChan <- op:
+		return nil
+	case <-s.closing:
+		return ErrSessionClosed
+	case <-s.finished:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend is like Send, but returns ErrSendQueueFull rather than waiting if the
+// queue is full.
+func (s *Session) TrySend(packet Packet) (err error) {
+	op, err := s.prepareSend(packet)
 	if err != nil {
 		return err
 	}
 	
-	return nil
+	select {
+	case s.outgoingChan <- op:
+		return nil
+	case <-s.closing:
+		return ErrSessionClosed
+	case <-s.finished:
+		return ErrSessionClosed
+	default:
+		return ErrSendQueueFull
+	}
 }
 
-func (s *Session) Send(packet Packet) {
-	if s.outgoingChan != nil {
-		s.outgoingChan <- packet
-	} else {
-		err := s.send(packet)
-		if err != nil {
-			log.Printf("Session error: %s", err.Error())
-		}
+// prepareSend encodes a packet to be queued.
+func (s *Session) prepareSend(packet Packet) (op outgoingPacket, err error) {
+	if s.isClosing() || s.isFinished() {
+		return op, ErrSessionClosed
+	}
+	
+	id := packet.ID()
+	state, passing := s.passingState()
+	if !passing {
+		return op, fmt.Errorf("Cannot send %s packet before the session is passing packets", id.String())
+	}
+	if id.State != state {
+		return op, fmt.Errorf("Cannot send %s packet in state %s", id.String(), state.String())
+	}
+	
+	op.data, err = s.encode(packet)
+	if err != nil {
+		return op, fmt.Errorf("Could not send %s packet: %s", packet.ID().String(), err.Error())
+	}
+	
+	op.dir = packet.ID().Direction
+	return op, nil
+}
+
+// passingState returns the state packets are being passed in, and whether the
+// session has started passing packets yet.
+func (s *Session) passingState() (state State, passing bool) {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	
+	return s.sendState, s.passing
+}
+
+func (s *Session) isFinished() bool {
+	select {
+	case <-s.finished:
+		return true
+	default:
+		return false
 	}
 }
 
 func (s *Session) setState(state State) {
+	oldState := s.state
 	s.state = state
 	log.Printf("Changing state: %s", state.String())
+	
+	s.Proxy.hm.Fire(s, &StateChangeEvent{oldState, state})
 }
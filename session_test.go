@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"github.com/kierdavis/proxy/chat"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandlePacketInvalidID(t *testing.T) {
+	p, err := New(Address{"127.0.0.1", 0}, Address{"127.0.0.1", 25565}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	p.AddRawGlobalHandler(func(s *Session, packet *RawPacket) bool {
+		return true
+	})
+	
+	clientConn, proxyConn := net.Pipe()
+	defer clientConn.Close()
+	defer proxyConn.Close()
+	
+	s := newSession(p, proxyConn)
+	s.state = Play
+	s.ProtocolVersion = testVersion
+	
+	tests := [][]byte{
+		nil,
+		bytes.Repeat([]byte{0xff}, 11),
+		bytes.Repeat([]byte{0x80}, 10),
+	}
+	
+	for _, packetData := range tests {
+		_, _, accept, err := s.handlePacket(packetData, Serverbound)
+		if err == nil || accept {
+			t.Errorf("%x: accepted", packetData)
+		}
+	}
+}
+
+// newPlayingSession returns a session that is passing packets in the Play state
+// in the given protocol version, with nothing on the other end of either
+// connection.
+func newPlayingSession(t *testing.T, version uint64) (s *Session) {
+	p, err := New(Address{"127.0.0.1", 0}, Address{"127.0.0.1", 25565}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	_, proxyConn := net.Pipe()
+	
+	s = newSession(p, proxyConn)
+	s.state = Play
+	s.sendState = Play
+	s.passing = true
+	s.ProtocolVersion = version
+	return s
+}
+
+func TestMessagesUnsupportedVersion(t *testing.T) {
+	message := chat.Text("hello")
+	
+	tests := []struct {
+		name string
+		send func(s *Session) error
+	}{
+		{"Kick", func(s *Session) error { return s.Kick(message) }},
+		{"SendMessage", func(s *Session) error { return s.SendMessage(message) }},
+		{"SendActionBar", func(s *Session) error { return s.SendActionBar(message) }},
+		{"SendTitle", func(s *Session) error { return s.SendTitle(message, message, time.Second, time.Second, time.Second) }},
+	}
+	
+	for _, test := range tests {
+		// 1.8 is supported, but 1.9.4 is not in the proxy's table of Play
+		// packet numbers.
+		err := test.send(newPlayingSession(t, 47))
+		if err != nil {
+			t.Errorf("%s in version 47: %s", test.name, err.Error())
+		}
+		
+		err = test.send(newPlayingSession(t, 110))
+		if err == nil {
+			t.Errorf("%s in version 110: expected an error", test.name)
+		}
+	}
+}
+
+func TestConnectUnsupportedVersion(t *testing.T) {
+	for _, version := range []uint64{110, 754, 763} {
+		s := newPlayingSession(t, version)
+		
+		err := s.Connect(Address{"127.0.0.1", 25565})
+		if err != ErrSwitchNotSupported {
+			t.Errorf("Version %d: got error %v, expected ErrSwitchNotSupported", version, err)
+		}
+		
+		if s.switching {
+			t.Errorf("Version %d: switch started", version)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/kierdavis/proxy/chat"
+	"io"
+	"log"
+)
+
+// Protocol version used when the proxy asks a server for its status itself.
+// Servers answer status requests from any version.
+const statusQueryVersion = 47
+
+// ServerStatus is the information shown in the client's server list.
+type ServerStatus struct {
+	Version StatusVersion
+	Players StatusPlayers
+	
+	// Message of the day.
+	Description *chat.Component
+	
+	// Server icon as a data URL, or empty if there is none. See SetFavicon.
+	Favicon string
+	
+	// Fields the proxy doesn't know about (such as mod lists), passed on
+	// unchanged.
+	Extra map[string]json.RawMessage
+}
+
+type StatusVersion struct {
+	Name string `json:"name"`
+	Protocol int `json:"protocol"`
+}
+
+type StatusPlayers struct {
+	Max int `json:"max"`
+	Online int `json:"online"`
+	
+	// Some of the players online, shown when the player count is hovered
+	// over.
+	Sample []StatusPlayer `json:"sample,omitempty"`
+}
+
+type StatusPlayer struct {
+	Name string `json:"name"`
+	ID string `json:"id"`
+}
+
+// A StatusHandler is called with the server's response to a server list ping
+// before it is passed on to the client, and may change it.
+type StatusHandler func(*Session, *ServerStatus)
+
+// ParseServerStatus parses the JSON sent in a status response.
+func ParseServerStatus(s string) (status *ServerStatus, err error) {
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal([]byte(s), &fields)
+	if err != nil {
+		return nil, err
+	}
+	
+	status = &ServerStatus{}
+	known := []struct {
+		name string
+		value interface{}
+	}{
+		{"version", &status.Version},
+		{"players", &status.Players},
+		{"description", &status.Description},
+		{"favicon", &status.Favicon},
+	}
+	
+	for _, f := range known {
+		data, ok := fields[f.name]
+		if !ok {
+			continue
+		}
+		
+		err = json.Unmarshal(data, f.value)
+		if err != nil {
+			return nil, err
+		}
+		
+		delete(fields, f.name)
+	}
+	
+	if len(fields) > 0 {
+		status.Extra = fields
+	}
+	
+	return status, nil
+}
+
+// JSON returns the status as sent in a status response.
+func (status *ServerStatus) JSON() (s string, err error) {
+	fields := make(map[string]interface{})
+	for name, value := range status.Extra {
+		fields[name] = value
+	}
+	
+	description := status.Description
+	if description == nil {
+		description = chat.Text("")
+	}
+	
+	fields["version"] = status.Version
+	fields["players"] = status.Players
+	fields["description"] = description
+	if status.Favicon != "" {
+		fields["favicon"] = status.Favicon
+	}
+	
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	
+	return string(buf), nil
+}
+
+// SetFavicon sets the server icon to a 64x64 PNG image.
+func (status *ServerStatus) SetFavicon(png []byte) {
+	status.Favicon = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+}
+
+// handleStatusResponse remembers a status response from the server and passes
+// it through the proxy's StatusHandler. Responses that can't be parsed are
+// passed on unchanged.
+func (s *Session) handleStatusResponse(packetData []byte) (newPacketData []byte, err error) {
+	packet := &SC0StatusResponsePacket{}
+	err = s.decode(packetData, packet)
+	if err != nil {
+		return nil, err
+	}
+	
+	s.Proxy.cacheStatus(s.ServerAddr, packet.JsonData)
+	
+	if s.Proxy.StatusHandler == nil {
+		return packetData, nil
+	}
+	
+	status, err := ParseServerStatus(packet.JsonData)
+	if err != nil {
+		log.Printf("Could not parse status response: %s", err.Error())
+		return packetData, nil
+	}
+	
+	s.Proxy.StatusHandler(s, status)
+	
+	packet.JsonData, err = status.JSON()
+	if err != nil {
+		return nil, err
+	}
+	
+	return s.encode(packet)
+}
+
+// cacheStatus remembers a status response from a server, to be shown while it
+// is down.
+func (proxy *Proxy) cacheStatus(serverAddr Address, jsonData string) {
+	proxy.lock.Lock()
+	proxy.statusCache[serverAddr] = jsonData
+	proxy.lock.Unlock()
+}
+
+// answerStatus answers a server list ping itself, when the proxy has a
+// StatusProvider or the server can't be reached.
+func (s *Session) answerStatus() (err error) {
+	s.setState(Status)
+	
+	request := &SS0StatusRequestPacket{}
+	err = s.recv(request)
+	if err != nil {
+		return err
+	}
+	
+	status, err := s.localStatus()
+	if err != nil {
+		return err
+	}
+	
+	if s.Proxy.StatusHandler != nil {
+		s.Proxy.StatusHandler(s, status)
+	}
+	
+	jsonData, err := status.JSON()
+	if err != nil {
+		return err
+	}
+	
+	err = s.send(&SC0StatusResponsePacket{jsonData})
+	if err != nil {
+		return err
+	}
+	
+	// The client may close the connection instead of pinging.
+	ping := &SS1StatusPingPacket{}
+	err = s.recv(ping)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	
+	return s.send(&SC1StatusPongPacket{ping.Payload})
+}
+
+// localStatus returns the status to answer a ping with when the ping isn't
+// passed on to the server: the combined status from the proxy's
+// StatusProvider, or if there is none or no server answers, the offline
+// status.
+func (s *Session) localStatus() (status *ServerStatus, err error) {
+	if s.Proxy.StatusProvider != nil {
+		status, err = s.Proxy.StatusProvider.status(s.Proxy.registry, s.ProtocolVersion)
+		if err == nil {
+			return status, nil
+		}
+		
+		log.Printf("Could not get status from any server: %s", err.Error())
+	}
+	
+	return s.offlineStatus()
+}
+
+// offlineStatus returns the status to show while the server is down: its last
+// status response if there is one and the proxy's OfflineStatus if not. The
+// status is a fresh copy, so that the StatusHandler can change it.
+func (s *Session) offlineStatus() (status *ServerStatus, err error) {
+	s.Proxy.lock.Lock()
+	jsonData, cached := s.Proxy.statusCache[s.ServerAddr]
+	s.Proxy.lock.Unlock()
+	
+	if !cached {
+		if s.Proxy.OfflineStatus == nil {
+			return &ServerStatus{Version: StatusVersion{Protocol: int(s.ProtocolVersion)}}, nil
+		}
+		
+		jsonData, err = s.Proxy.OfflineStatus.JSON()
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	status, err = ParseServerStatus(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !cached && status.Version.Protocol == 0 {
+		status.Version.Protocol = int(s.ProtocolVersion)
+	}
+	
+	return status, nil
+}
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// StatusBackend is a server whose status is included by a StatusProvider.
+type StatusBackend struct {
+	Addr Address
+	
+	// If not empty or 0, used in place of the version name and protocol
+	// version the server reports.
+	VersionName string
+	Protocol int
+}
+
+// A StatusProvider answers server list pings itself with the combined status
+// of several servers. The player counts and samples of the servers that answer
+// are added together. The version is that of the first server to answer whose
+// protocol version matches the client's, if any, and everything else comes
+// from the first server in Backends to answer.
+type StatusProvider struct {
+	Backends []StatusBackend
+	
+	// How long to wait for each server to answer.
+	Timeout time.Duration
+	
+	// How long a server's status, or its failure to answer, is remembered
+	// before it is pinged again.
+	CacheTime time.Duration
+	
+	// Most players shown in the combined sample, or 0 for no limit.
+	MaxSample int
+	
+	lock sync.Mutex
+	cache map[Address]*backendStatus
+}
+
+type backendStatus struct {
+	jsonData string
+	err error
+	time time.Time
+}
+
+func NewStatusProvider(backends ...StatusBackend) (sp *StatusProvider) {
+	return &StatusProvider{
+		Backends: backends,
+		Timeout: 3 * time.Second,
+		CacheTime: 5 * time.Second,
+		MaxSample: 12,
+		cache: make(map[Address]*backendStatus),
+	}
+}
+
+// status returns the combined status for a client with the given protocol
+// version, pinging the servers whose status isn't cached at the same time.
+func (sp *StatusProvider) status(registry *Registry, protocolVersion uint64) (status *ServerStatus, err error) {
+	backends := sp.Backends
+	results := make([]*backendStatus, len(backends))
+	
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, addr Address) {
+			defer wg.Done()
+			results[i] = sp.backendStatus(registry, addr)
+		}(i, backend.Addr)
+	}
+	wg.Wait()
+	
+	err = fmt.Errorf("No servers to ping")
+	versionMatched := false
+	seen := make(map[string]bool)
+	var sample []StatusPlayer
+	
+	for i, result := range results {
+		if result.err != nil {
+			err = result.err
+			continue
+		}
+		
+		bs, parseErr := ParseServerStatus(result.jsonData)
+		if parseErr != nil {
+			err = fmt.Errorf("Could not parse status of %s: %s", backends[i].Addr.String(), parseErr.Error())
+			log.Printf("%s", err.Error())
+			continue
+		}
+		
+		if backends[i].VersionName != "" {
+			bs.Version.Name = backends[i].VersionName
+		}
+		if backends[i].Protocol != 0 {
+			bs.Version.Protocol = backends[i].Protocol
+		}
+		
+		if status == nil {
+			status = bs
+		} else {
+			status.Players.Online += bs.Players.Online
+			status.Players.Max += bs.Players.Max
+		}
+		
+		if !versionMatched && bs.Version.Protocol == int(protocolVersion) {
+			status.Version = bs.Version
+			versionMatched = true
+		}
+		
+		for _, player := range bs.Players.Sample {
+			if seen[player.ID] || (sp.MaxSample > 0 && len(sample) >= sp.MaxSample) {
+				continue
+			}
+			
+			seen[player.ID] = true
+			sample = append(sample, player)
+		}
+	}
+	
+	if status == nil {
+		return nil, err
+	}
+	
+	status.Players.Sample = sample
+	return status, nil
+}
+
+// backendStatus returns the cached status of a server, pinging it if the
+// cached status is out of date.
+func (sp *StatusProvider) backendStatus(registry *Registry, addr Address) (result *backendStatus) {
+	sp.lock.Lock()
+	result = sp.cache[addr]
+	sp.lock.Unlock()
+	
+	if result != nil && time.Since(result.time) < sp.CacheTime {
+		return result
+	}
+	
+	jsonData, err := pingServer(registry, addr, sp.Timeout)
+	if err != nil {
+		log.Printf("Could not get status of %s: %s", addr.String(), err.Error())
+	}
+	
+	result = &backendStatus{jsonData, err, time.Now()}
+	
+	sp.lock.Lock()
+	if sp.cache == nil {
+		sp.cache = make(map[Address]*backendStatus)
+	}
+	sp.cache[addr] = result
+	sp.lock.Unlock()
+	
+	return result
+}
+
+// pingServer asks a server for its status, giving up after the timeout if it
+// is not 0.
+func pingServer(registry *Registry, addr Address, timeout time.Duration) (jsonData string, err error) {
+	conn, err := net.DialTimeout("tcp", addr.String(), timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	
+	c := newCodec(conn)
+	
+	requests := []Packet{
+		&HS0HandshakePacket{statusQueryVersion, addr.Host, uint16(addr.Port), 1},
+		&SS0StatusRequestPacket{},
+	}
+	for _, packet := range requests {
+		packetData, err := registry.encode(packet, statusQueryVersion)
+		if err != nil {
+			return "", err
+		}
+		
+		err = c.Write(packetData)
+		if err != nil {
+			return "", err
+		}
+	}
+	
+	packetData, err := c.Read()
+	if err != nil {
+		return "", err
+	}
+	
+	response := &SC0StatusResponsePacket{}
+	err = registry.decode(packetData, response, statusQueryVersion)
+	if err != nil {
+		return "", err
+	}
+	
+	return response.JsonData, nil
+}
@@ -1,7 +1,10 @@
 package proxy
 
 import (
+	"encoding/hex"
 	"fmt"
+	"github.com/kierdavis/proxy/nbt"
+	"strings"
 )
 
 type State int
@@ -58,8 +61,50 @@ func (id PacketID) String() (s string) {
 
 type Packet interface {
 	ID() PacketID
-	Read(BinaryReader)
-	Write(BinaryWriter)
+	Read(BinaryReader) error
+	Write(BinaryWriter) error
+}
+
+// VersionedPacket is implemented by packets whose ID depends on the protocol
+// version. ID returns the packet's ID in the newest supported version.
+type VersionedPacket interface {
+	Packet
+	
+	// VersionID returns the packet's ID in the given protocol version, or
+	// false if the packet does not exist in that version.
+	VersionID(version uint64) (id PacketID, ok bool)
+}
+
+// DecodeError is returned when a packet body can't be decoded.
+type DecodeError struct {
+	PacketID PacketID
+	Field string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("Error decoding %s packet: %s", e.PacketID.String(), e.Err.Error())
+	}
+	return fmt.Sprintf("Error decoding field %s of %s packet: %s", e.Field, e.PacketID.String(), e.Err.Error())
+}
+
+// FieldError wraps an error encountered while reading the named field of a
+// packet. It is intended for use in Packet.Read implementations; the packet ID
+// is filled in by the caller.
+func FieldError(field string, err error) error {
+	return &DecodeError{Field: field, Err: err}
+}
+
+// packetError attaches a packet ID to an error returned by Packet.Read.
+func packetError(id PacketID, err error) error {
+	e, ok := err.(*DecodeError)
+	if !ok {
+		e = &DecodeError{Err: err}
+	}
+	
+	e.PacketID = id
+	return e
 }
 
 type Address struct {
@@ -71,9 +116,101 @@ func (addr Address) String() (s string) {
 	return fmt.Sprintf("%s:%d", addr.Host, addr.Port)
 }
 
+// Slot is the contents of an inventory slot. Empty slots are read and written
+// as a nil *Slot.
 type Slot struct {
-	Item uint16
-	Count uint8
-	Damage uint16
-	NBT []byte
+	Item int32
+	Count int8
+	
+	// Damage is only sent before 1.13, after which it is kept in the NBT.
+	Damage int16
+	
+	// NBT is the item's tag, or nil if it has none.
+	NBT nbt.Compound
+}
+
+// DecodeNBT decodes the item's tag into the value pointed to by v; see
+// nbt.Decode. It does nothing if the item has no tag.
+func (slot *Slot) DecodeNBT(v interface{}) (err error) {
+	if slot.NBT == nil {
+		return nil
+	}
+	return nbt.Decode(slot.NBT, v)
+}
+
+// Protocol versions in which the layout of slots changed.
+const (
+	// 1.8: the NBT is sent as is rather than gzipped and prefixed with its
+	// length.
+	slotInlineNBTVersion = 47
+	
+	// 1.13: the damage is no longer sent.
+	slotNoDamageVersion = 393
+	
+	// 1.13.2: slots start with a bool saying whether they are empty, and the
+	// item ID is sent as a varint.
+	slotPresentVersion = 404
+	
+	// 1.20.5: items are described by components rather than NBT, which is
+	// not supported.
+	slotComponentsVersion = 766
+)
+
+// Protocol version (1.20.2) from which the root tag of network NBT has no name.
+const namelessNBTVersion = 764
+
+type UUID [16]byte
+
+// ParseUUID parses a UUID in its string form, with or without hyphens.
+func ParseUUID(s string) (uuid UUID, err error) {
+	buf, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(buf) != 16 {
+		return uuid, fmt.Errorf("Invalid UUID %q", s)
+	}
+	
+	copy(uuid[:], buf)
+	return uuid, nil
+}
+
+// String returns the UUID in its hyphenated form.
+func (uuid UUID) String() (s string) {
+	s = hex.EncodeToString(uuid[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// Position is a block position. Y is limited to 12 bits and X and Z to 26 bits
+// when sent.
+type Position struct {
+	X int32
+	Y int32
+	Z int32
+}
+
+// Protocol version (1.14) from which positions are packed as X, Z, Y rather
+// than X, Y, Z.
+const packedPositionVersion = 477
+
+// BitSet is a set of bits laid out as in the protocol: bit i is bit i % 64 of
+// element i / 64.
+type BitSet []uint64
+
+// Get returns whether bit i is set.
+func (bs BitSet) Get(i int) bool {
+	if i < 0 || i / 64 >= len(bs) {
+		return false
+	}
+	return bs[i / 64] & (1 << uint(i % 64)) != 0
+}
+
+// Set sets or clears bit i, growing the set if needed.
+func (bs *BitSet) Set(i int, value bool) {
+	for i / 64 >= len(*bs) {
+		*bs = append(*bs, 0)
+	}
+	
+	if value {
+		(*bs)[i / 64] |= 1 << uint(i % 64)
+	} else {
+		(*bs)[i / 64] &^= 1 << uint(i % 64)
+	}
 }